@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// batchSurvey is a survey found by findSurveys
+type batchSurvey struct {
+	qsfPath string
+	xmlPath string
+	base    string // output files are named after this path, as in outputBase
+}
+
+// batchResult is the outcome of converting one survey of a batch
+type batchResult struct {
+	qsfPath   string
+	title     string
+	responses int
+	columns   int
+	warnings  int
+	err       error
+}
+
+// convertDirs converts every survey found in dirs, running up to jobs conversions at once. Surveys that fail don't stop the others;
+// once all are done, it prints a summary of each and exits with the status of the most severe failure.
+func convertDirs(dirs []string, opts options, jobs int) {
+	status, err := convertBatch(os.Stdout, dirs, opts, jobs)
+	if err != nil {
+		fatal(err)
+	}
+	if status != 0 {
+		os.Exit(status)
+	}
+}
+
+// convertBatch converts every survey found in dirs as convertDirs does, writing the summary to w.
+// It returns the status of the most severe failure, or 0 if every survey was converted.
+func convertBatch(w io.Writer, dirs []string, opts options, jobs int) (int, error) {
+	surveys := []batchSurvey{}
+	for _, dir := range dirs {
+		found, err := findSurveys(dir, opts.outDir)
+		if err != nil {
+			return 0, err
+		}
+		surveys = append(surveys, found...)
+	}
+	if len(surveys) == 0 {
+		return 0, errorf(exitInput, "No surveys with responses files found in %s", strings.Join(dirs, ", "))
+	}
+	log.Printf("Converting %d surveys", len(surveys))
+
+	results := make([]batchResult, len(surveys))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs && i < len(surveys); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				results[j] = convertSurvey(surveys[j], opts)
+			}
+		}()
+	}
+	for i := range surveys {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	printBatchSummary(w, results)
+	status := 0
+	for _, r := range results {
+		if r.err != nil && exitStatus(r.err) > status {
+			status = exitStatus(r.err)
+		}
+	}
+	return status, nil
+}
+
+// findSurveys returns every QSF file in dir or its subdirectories that has an XML responses file with the same base name;
+// the extensions' case doesn't matter, so survey.QSF can have survey.xml or survey.XML.
+// If outDir is set, each survey's output goes to the same relative path within outDir.
+func findSurveys(dir, outDir string) ([]batchSurvey, error) {
+	surveys := []batchSurvey{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".qsf") {
+			return nil
+		}
+		xmlPath := findXMLPath(path)
+		if xmlPath == "" {
+			log.Printf("Skipping '%s': no responses file '%s'", path, buildXMLPath(path))
+			return nil
+		}
+		base, err := surveyBase(dir, outDir, path)
+		if err != nil {
+			return err
+		}
+		surveys = append(surveys, batchSurvey{path, xmlPath, base})
+		return nil
+	})
+	if err != nil {
+		return nil, errorf(exitInput, "Error searching '%s': %s", dir, err)
+	}
+	return surveys, nil
+}
+
+// findXMLPath returns the XML file with qsfPath's base name and an .xml extension in any case, or "" if there isn't one
+func findXMLPath(qsfPath string) string {
+	if _, err := os.Stat(buildXMLPath(qsfPath)); err == nil {
+		return buildXMLPath(qsfPath)
+	}
+	entries, err := os.ReadDir(filepath.Dir(qsfPath))
+	if err != nil {
+		return ""
+	}
+	name := filepath.Base(buildXMLPath(qsfPath))
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(filepath.Ext(e.Name()), ".xml") &&
+			strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())) == strings.TrimSuffix(name, ".xml") {
+			return filepath.Join(filepath.Dir(qsfPath), e.Name())
+		}
+	}
+	return ""
+}
+
+// surveyBase returns the output base for qsfPath, found within root; if outDir is set, it mirrors qsfPath's location relative to root
+func surveyBase(root, outDir, qsfPath string) (string, error) {
+	if outDir == "" {
+		return outputBase(qsfPath, ""), nil
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(qsfPath))
+	if err != nil {
+		return "", err
+	}
+	return outputBase(qsfPath, filepath.Join(outDir, rel)), nil
+}
+
+// convertSurvey converts one survey of a batch, logging its warnings and errors
+func convertSurvey(bs batchSurvey, opts options) batchResult {
+	result := batchResult{qsfPath: bs.qsfPath}
+	s, warnings, err := loadSurvey(bs.qsfPath, bs.xmlPath, opts)
+	if err == nil {
+		for _, w := range warnings {
+			log.Printf("Warning: %s: %s", bs.qsfPath, w)
+		}
+		result.title = s.Title
+		result.responses = len(s.Responses)
+		result.warnings = len(warnings)
+		for _, cols := range s.ColumnNames() {
+			result.columns += len(cols)
+		}
+		err = writeSurvey(s, bs.base, opts)
+	}
+	if err != nil {
+		log.Print(err)
+		result.err = err
+	}
+	return result
+}
+
+// printBatchSummary writes a table describing the outcome of each conversion, sorted by QSF path
+func printBatchSummary(w io.Writer, results []batchResult) {
+	sort.SliceStable(results, func(i, j int) bool { return results[i].qsfPath < results[j].qsfPath })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "survey\ttitle\tresponses\tcolumns\twarnings\terrors")
+	failed := 0
+	for _, r := range results {
+		errors := "-"
+		if r.err != nil {
+			errors = r.err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", r.qsfPath, r.title, r.responses, r.columns, r.warnings, errors)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d surveys converted, %d failed\n", len(results)-failed, failed)
+}
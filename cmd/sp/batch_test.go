@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files, keyed by their paths relative to root, with the given contents
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err = %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err = %s", err)
+		}
+	}
+}
+
+func TestFindSurveys(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"survey.qsf":      "",
+		"survey.xml":      "",
+		"a/upper.QSF":     "",
+		"a/upper.xml":     "",
+		"a/caps.QSF":      "",
+		"a/caps.XML":      "",
+		"b/c/deep.qsf":    "",
+		"b/c/deep.xml":    "",
+		"b/alone.qsf":     "",
+		"b/other.xml":     "",
+		"b/c/survey.json": "",
+	})
+
+	tests := []struct {
+		outDir string
+		want   []string // each survey's QSF file, responses file, and output base, relative to root
+	}{
+		{"", []string{
+			"a/caps.QSF a/caps.XML a/caps",
+			"a/upper.QSF a/upper.xml a/upper",
+			"b/c/deep.qsf b/c/deep.xml b/c/deep",
+			"survey.qsf survey.xml survey",
+		}},
+		{filepath.Join(root, "out"), []string{
+			"a/caps.QSF a/caps.XML out/a/caps",
+			"a/upper.QSF a/upper.xml out/a/upper",
+			"b/c/deep.qsf b/c/deep.xml out/b/c/deep",
+			"survey.qsf survey.xml out/survey",
+		}},
+	}
+	rel := func(path string) string {
+		r, _ := filepath.Rel(root, path)
+		return filepath.ToSlash(r)
+	}
+	for _, test := range tests {
+		surveys, err := findSurveys(root, test.outDir)
+		if err != nil {
+			t.Errorf("err = %s", err)
+			continue
+		}
+		got := []string{}
+		for _, s := range surveys {
+			got = append(got, rel(s.qsfPath)+" "+rel(s.xmlPath)+" "+rel(s.base))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("findSurveys(%q) = \n%s\nwant\n%s", test.outDir, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestSurveyBase(t *testing.T) {
+	tests := []struct {
+		root, outDir, qsfPath string
+		want                  string
+	}{
+		{"in", "", filepath.Join("in", "a", "survey.qsf"), filepath.Join("in", "a", "survey")},
+		{"in", "out", filepath.Join("in", "survey.qsf"), filepath.Join("out", "survey")},
+		{"in", "out", filepath.Join("in", "a", "b", "survey.QSF"), filepath.Join("out", "a", "b", "survey")},
+		{".", "out", filepath.Join("a", "survey.qsf"), filepath.Join("out", "a", "survey")},
+	}
+	for _, test := range tests {
+		got, err := surveyBase(test.root, test.outDir, test.qsfPath)
+		if err != nil {
+			t.Errorf("err = %s", err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("surveyBase(%q, %q, %q) = %q; want %q", test.root, test.outDir, test.qsfPath, got, test.want)
+		}
+	}
+}
+
+func TestConvertBatch(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"good/survey.qsf": string(serveTestQsf(t)),
+		"good/survey.xml": serveTestXML,
+		"bad/broken.qsf":  "{",
+		"bad/broken.xml":  serveTestXML,
+		"empty/notes.txt": "",
+		"out-file":        "",
+	})
+	good, bad := filepath.Join(root, "good"), filepath.Join(root, "bad")
+
+	tests := []struct {
+		name   string
+		dirs   []string
+		outDir string
+		status int
+		want   string // the summary's last line
+	}{
+		{"converts", []string{good}, filepath.Join(root, "out"), 0, "1 surveys converted, 0 failed"},
+		{"continues past failures", []string{bad, good}, filepath.Join(root, "out"), exitInput, "1 surveys converted, 1 failed"},
+		{"output errors", []string{good}, filepath.Join(root, "out-file"), exitOutput, "0 surveys converted, 1 failed"},
+	}
+	for _, test := range tests {
+		var summary strings.Builder
+		status, err := convertBatch(&summary, test.dirs, options{format: "csv", outDir: test.outDir}, 2)
+		if err != nil {
+			t.Errorf("%s: err = %s", test.name, err)
+			continue
+		}
+		if status != test.status {
+			t.Errorf("%s: status = %d; want %d", test.name, status, test.status)
+		}
+		lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+		if got := lines[len(lines)-1]; got != test.want {
+			t.Errorf("%s: summary ends with %q; want %q", test.name, got, test.want)
+		}
+		if len(lines) != len(test.dirs)+3 || !strings.HasPrefix(lines[0], "survey") {
+			t.Errorf("%s: summary = \n%s\nwant a header and a row per survey", test.name, summary.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "out", "survey.csv")); err != nil {
+		t.Errorf("convertBatch() didn't write the output: %s", err)
+	}
+
+	_, err := convertBatch(io.Discard, []string{filepath.Join(root, "empty")}, options{format: "csv"}, 1)
+	if err == nil || exitStatus(err) != exitInput {
+		t.Errorf("convertBatch() of a directory without surveys: err = %v; want exit status %d", err, exitInput)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// codebook writes a CSV describing each column that convert would write, to standard output or a file in the output directory
+func codebook(args []string) {
+	fs := flag.NewFlagSet("codebook", flag.ExitOnError)
+	columns := addColumnFlags(fs)
+	responses := fs.String("responses", "", "also read responses from this XML or CSV `file`, to infer the types of embedded data fields")
+	outDir := fs.String("o", "-", "write <survey>_codebook.csv to this `directory`, or - for standard output")
+	fs.StringVar(outDir, "out-dir", "-", "same as -o")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp codebook [flags] <qsf file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	opts := options{}
+	columns.apply(&opts)
+	qsfPath := fs.Arg(0)
+	checkStdin(qsfPath, *responses)
+	s, warnings, err := loadSurvey(qsfPath, *responses, opts)
+	if err != nil {
+		fatal(err)
+	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
+
+	path := "standard output"
+	f := os.Stdout
+	if *outDir != "-" {
+		path = outputBase(qsfPath, *outDir) + "_codebook.csv"
+		if f, err = create(path); err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+	}
+	if err := s.WriteCodebook(bufio.NewWriter(f)); err != nil {
+		fatalf(exitOutput, "Error writing '%s': %s", path, err)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// options holds the command-line settings that control how a survey is converted
+type options struct {
+	includeMetadata bool
+	excludePII      bool
+	numericCodes    bool
+	lang            string
+	filters         []libsp.ResponseFilter
+	long            bool
+	format          string
+	mergeBy         string
+	naming          libsp.NamingStrategy
+	outDir          string
+}
+
+// columnFlags are the flags that choose which columns are written and how, shared by convert, codebook, and stats
+type columnFlags struct {
+	metadata *bool
+	noPII    *bool
+	numeric  *bool
+	lang     *string
+	naming   *string
+}
+
+func addColumnFlags(fs *flag.FlagSet) *columnFlags {
+	return &columnFlags{
+		metadata: fs.Bool("metadata", false, "include response metadata (dates, status, location, etc.) in the CSV"),
+		noPII:    fs.Bool("no-pii", false, "exclude metadata that may identify respondents (IP address, location, recipient details)"),
+		numeric:  fs.Bool("numeric", false, "write choices' recode values instead of their labels"),
+		lang:     fs.String("lang", "", "write choice labels using this translation `language` code (e.g., DE)"),
+		naming:   fs.String("naming", "default", "column naming `strategy`: default, qid, export_tag, label_slug, or snake_case, optionally followed by ,max_length:N"),
+	}
+}
+
+// apply copies the flags' values to opts
+func (f *columnFlags) apply(opts *options) {
+	opts.includeMetadata = *f.metadata
+	opts.excludePII = *f.noPII
+	opts.numericCodes = *f.numeric
+	opts.lang = *f.lang
+	naming, err := libsp.ParseNamingStrategy(*f.naming)
+	if err != nil {
+		fatalf(exitUsage, "Error parsing -naming: %s", err)
+	}
+	opts.naming = naming
+}
+
+// filterFlags are the flags that choose which responses are included, shared by convert and stats
+type filterFlags struct {
+	finishedOnly   *bool
+	minProgress    *int
+	since          *string
+	until          *string
+	excludePreview *bool
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		finishedOnly:   fs.Bool("finished-only", false, "only include finished responses"),
+		minProgress:    fs.Int("min-progress", 0, "only include responses with at least this percent `progress`"),
+		since:          fs.String("since", "", "only include responses recorded on or after this `date` (YYYY-MM-DD [HH:MM:SS])"),
+		until:          fs.String("until", "", "only include responses recorded on or before this `date` (YYYY-MM-DD [HH:MM:SS])"),
+		excludePreview: fs.Bool("exclude-preview", false, "exclude survey previews and test responses"),
+	}
+}
+
+// apply adds the selected filters to opts
+func (f *filterFlags) apply(opts *options) {
+	if *f.finishedOnly {
+		opts.filters = append(opts.filters, libsp.FinishedOnly())
+	}
+	if *f.minProgress > 0 {
+		opts.filters = append(opts.filters, libsp.MinProgress(*f.minProgress))
+	}
+	if *f.since != "" {
+		t, err := parseDate(*f.since, false)
+		if err != nil {
+			fatalf(exitUsage, "Error parsing -since: %s", err)
+		}
+		opts.filters = append(opts.filters, libsp.RecordedSince(t))
+	}
+	if *f.until != "" {
+		t, err := parseDate(*f.until, true)
+		if err != nil {
+			fatalf(exitUsage, "Error parsing -until: %s", err)
+		}
+		opts.filters = append(opts.filters, libsp.RecordedUntil(t))
+	}
+	if *f.excludePreview {
+		opts.filters = append(opts.filters, libsp.ExcludePreviews())
+	}
+}
+
+// convert writes a survey's responses in the selected format; given several QSF files, it merges them as waves of the same survey.
+// With -r, it converts every survey found in the given directories instead.
+func convert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	columns := addColumnFlags(fs)
+	filters := addFilterFlags(fs)
+	format := fs.String("format", "csv", "output `format`: csv (CSV and R script), sqlite, parquet, or xlsx")
+	long := fs.Bool("long", false, "also write responses in long format (one row per respondent and question column)")
+	mergeBy := fs.String("merge-by", "export_tag", "when merging several waves, match questions by `key`: export_tag or qid")
+	responses := fs.String("responses", "", "read responses from this XML or CSV `file` (default: the QSF file's name with an .xml extension)")
+	recursive := fs.Bool("r", false, "convert every survey with a responses file in the given directories and their subdirectories")
+	jobs := fs.Int("j", runtime.NumCPU(), "with -r, convert up to this `number` of surveys at once")
+	var outDir string
+	fs.StringVar(&outDir, "o", "", "write output files to this `directory`, or - for standard output (default: the QSF file's directory)")
+	fs.StringVar(&outDir, "out-dir", "", "same as -o")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp convert [flags] <qsf file>\n  sp convert [flags] <qsf file> <qsf file>...\n  sp convert -r [flags] <directory>...\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	opts := options{long: *long, format: *format, mergeBy: *mergeBy, outDir: outDir}
+	columns.apply(&opts)
+	filters.apply(&opts)
+	switch opts.format {
+	case "csv", "sqlite", "parquet", "xlsx":
+	default:
+		fatalf(exitUsage, "Unknown output format '%s'", opts.format)
+	}
+	if opts.outDir == "-" && (opts.format == "sqlite" || opts.long || *recursive) {
+		fatalf(exitUsage, "Only csv, parquet, and xlsx output of a single survey without -long can be written to standard output")
+	}
+
+	if *recursive {
+		if *responses != "" {
+			fatalf(exitUsage, "-responses can't be used with -r")
+		}
+		if *jobs < 1 {
+			fatalf(exitUsage, "-j must be at least 1")
+		}
+		convertDirs(fs.Args(), opts, *jobs)
+		return
+	}
+	if fs.NArg() > 1 {
+		if *responses != "" {
+			fatalf(exitUsage, "-responses can't be used when merging several waves")
+		}
+		mergeSurveys(fs.Args(), opts)
+		return
+	}
+	qsfPath := fs.Arg(0)
+	xmlPath := responsesPath(qsfPath, *responses)
+	checkStdin(qsfPath, xmlPath)
+	s, warnings, err := loadSurvey(qsfPath, xmlPath, opts)
+	if err != nil {
+		fatal(err)
+	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
+	if err = writeSurvey(s, outputBase(qsfPath, opts.outDir), opts); err != nil {
+		fatal(err)
+	}
+	log.Println("Completed successfully!")
+}
+
+// mergeSurveys combines the responses to several waves of a survey, writing them next to the first wave's QSF file
+func mergeSurveys(qsfPaths []string, opts options) {
+	waves := []libsp.Wave{}
+	for _, qsfPath := range qsfPaths {
+		if qsfPath == "-" {
+			fatalf(exitUsage, "Waves can't be read from standard input")
+		}
+		name := strings.TrimSuffix(filepath.Base(qsfPath), filepath.Ext(qsfPath))
+		s, warnings, err := loadSurvey(qsfPath, buildXMLPath(qsfPath), opts)
+		if err != nil {
+			fatal(err)
+		}
+		for _, w := range warnings {
+			log.Printf("Warning: %s: %s", qsfPath, w)
+		}
+		waves = append(waves, libsp.Wave{Name: name, Survey: s})
+	}
+	key := libsp.MergeByExportTag
+	switch opts.mergeBy {
+	case "export_tag":
+	case "qid":
+		key = libsp.MergeByID
+	default:
+		fatalf(exitUsage, "Unknown -merge-by value '%s'", opts.mergeBy)
+	}
+	s, report, err := libsp.MergeWaves(waves, key)
+	if err != nil {
+		fatalf(exitInput, "Error merging surveys: %s", err)
+	}
+	log.Printf("Merged %d waves, %d responses", len(waves), len(s.Responses))
+	log.Printf("%s", report)
+	for _, r := range s.RenamedColumns() {
+		log.Printf("Warning: %s", r)
+	}
+	if err = writeSurvey(s, outputBase(qsfPaths[0], opts.outDir)+"_merged", opts); err != nil {
+		fatal(err)
+	}
+	log.Println("Completed successfully!")
+}
+
+// loadSurvey reads a survey and its responses (unless xmlPath is empty), applying the options that affect parsing and filtering.
+// It also returns warnings about the survey's scores, overrides, and column names.
+func loadSurvey(qsfPath, xmlPath string, opts options) (*libsp.Survey, []string, error) {
+	s, err := readQsf(qsfPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = configureColumns(s, opts); err != nil {
+		return nil, nil, err
+	}
+
+	warnings := []string{}
+	if xmlPath != "" {
+		if err = readResponses(s, xmlPath); err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, s.ScoreMismatches()...)
+	}
+	o, err := readOverrides(qsfPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o != nil {
+		warnings = append(warnings, o.Validate(s)...)
+		s.ApplyOverrides(o)
+	}
+	if len(opts.filters) > 0 {
+		removed := s.FilterResponses(opts.filters...)
+		log.Printf("Filtered out %d responses, %d remaining", removed, len(s.Responses))
+	}
+	warnings = append(warnings, s.RenamedColumns()...)
+	return s, warnings, nil
+}
+
+// configureColumns applies the options that select and name s's columns
+func configureColumns(s *libsp.Survey, opts options) error {
+	s.IncludeMetadata = opts.includeMetadata
+	s.ExcludePII = opts.excludePII
+	s.NumericCodes = opts.numericCodes
+	s.Naming = opts.naming
+	if err := s.SetLanguage(opts.lang); err != nil {
+		return errorf(exitUsage, "Error selecting language: %s", err)
+	}
+	return nil
+}
+
+// writeSurvey writes s in the selected format, to files named after base (a path without an extension) or to standard output
+func writeSurvey(s *libsp.Survey, base string, opts options) error {
+	if opts.outDir == "-" {
+		return writeStdout(s, opts)
+	}
+	var err error
+	switch opts.format {
+	case "csv":
+		err = writeCSVAndR(s, base)
+	case "sqlite":
+		err = writeSQLite(s, base)
+	case "parquet":
+		err = writeParquet(s, base)
+	case "xlsx":
+		err = writeXLSX(s, base)
+	}
+	if err == nil && opts.long {
+		err = writeLong(s, base)
+	}
+	return err
+}
+
+// writeStdout writes the survey's data to standard output; for CSV output, the R script is not written
+func writeStdout(s *libsp.Survey, opts options) error {
+	w := bufio.NewWriter(os.Stdout)
+	var err error
+	switch opts.format {
+	case "csv":
+		err = s.WriteCSV(w)
+	case "parquet":
+		err = s.WriteParquet(w)
+	case "xlsx":
+		err = s.WriteXLSX(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return errorf(exitOutput, "Error writing to standard output: %s", err)
+	}
+	return nil
+}
+
+func writeCSVAndR(s *libsp.Survey, base string) error {
+	csvPath := base + ".csv"
+	csv, err := create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csv.Close()
+	w := bufio.NewWriter(csv)
+	err = s.WriteCSV(w)
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", csvPath, err)
+	}
+
+	rPath := base + ".r"
+	r, err := create(rPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w = bufio.NewWriter(r)
+	err = s.WriteR(w, filepath.Base(csvPath))
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", rPath, err)
+	}
+	return nil
+}
+
+func writeSQLite(s *libsp.Survey, base string) error {
+	dbPath := base + ".sqlite"
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return errorf(exitOutput, "Error creating '%s': %s", filepath.Dir(dbPath), err)
+	}
+	log.Printf("Writing '%s'", dbPath)
+	if err := s.WriteSQLite(dbPath); err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", dbPath, err)
+	}
+	return nil
+}
+
+func writeParquet(s *libsp.Survey, base string) error {
+	parquetPath := base + ".parquet"
+	f, err := create(parquetPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = s.WriteParquet(bufio.NewWriter(f))
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", parquetPath, err)
+	}
+	return nil
+}
+
+func writeXLSX(s *libsp.Survey, base string) error {
+	xlsxPath := base + ".xlsx"
+	f, err := create(xlsxPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = s.WriteXLSX(bufio.NewWriter(f))
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", xlsxPath, err)
+	}
+	return nil
+}
+
+func writeLong(s *libsp.Survey, base string) error {
+	csvPath := base + "_long.csv"
+	csv, err := create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csv.Close()
+	err = s.WriteLongCSV(bufio.NewWriter(csv))
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", csvPath, err)
+	}
+
+	rPath := base + "_long.r"
+	r, err := create(rPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	err = s.WriteLongR(bufio.NewWriter(r), filepath.Base(csvPath))
+	if err != nil {
+		return errorf(exitOutput, "Error writing '%s': %s", rPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// diff prints the structural changes between two versions of a survey, as text or JSON.
+// Like diff(1), it exits with status 1 if the surveys differ.
+func diff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the changes as a JSON array")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp diff [flags] <old qsf file> <new qsf file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	checkStdin(fs.Arg(0), fs.Arg(1))
+
+	old, err := readQsf(fs.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	current, err := readQsf(fs.Arg(1))
+	if err != nil {
+		fatal(err)
+	}
+	changes := libsp.DiffSurveys(old, current)
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			fatalf(exitOutput, "Error encoding changes: %s", err)
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Fprintln(w, c)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fatalf(exitOutput, "Error writing to standard output: %s", err)
+	}
+	if len(changes) > 0 {
+		os.Exit(exitFindings)
+	}
+}
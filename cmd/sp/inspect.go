@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// inspect prints sp's interpretation of a survey, as text or JSON
+func inspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the parsed survey as JSON")
+	responses := fs.String("responses", "", "also read responses from this XML or CSV `file` and include them in JSON output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp inspect [flags] <qsf file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	qsfPath := fs.Arg(0)
+	checkStdin(qsfPath, *responses)
+	s, err := readQsf(qsfPath)
+	if err != nil {
+		fatal(err)
+	}
+	if *responses != "" {
+		if err = readResponses(s, *responses); err != nil {
+			fatal(err)
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		if err := s.WriteJSON(w); err != nil {
+			fatalf(exitOutput, "Error writing survey: %s", err)
+		}
+	} else {
+		printSurvey(w, s)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf(exitOutput, "Error writing to standard output: %s", err)
+	}
+}
+
+func printSurvey(w *bufio.Writer, s *libsp.Survey) {
+	fmt.Fprintf(w, "%s (%s)\n", s.Title, s.ID)
+	if s.Description != "" {
+		fmt.Fprintf(w, "%s\n", s.Description)
+	}
+	fmt.Fprintf(w, "Status: %s, %d questions", s.Status, len(s.QuestionOrder))
+	if len(s.Responses) > 0 {
+		fmt.Fprintf(w, ", %d responses", len(s.Responses))
+	}
+	fmt.Fprintf(w, "\n\n")
+	names := s.ColumnNames()
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		fmt.Fprintf(w, "%s [%s] %s\n", q.ID, q.Type(), q.Wording)
+		fmt.Fprintf(w, "\tcolumns: %s\n", strings.Join(names[q.ID], ", "))
+	}
+}
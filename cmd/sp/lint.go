@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// lintResult is a lint issue found in one of the linted files
+type lintResult struct {
+	File string `json:"file"`
+	libsp.LintIssue
+}
+
+// lint checks surveys for design problems that hurt analysis. It exits with status 1 if any errors
+// (or, with -strict, any warnings) are found, so it can be run as a CI check.
+func lint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the issues as a JSON array")
+	strict := fs.Bool("strict", false, "exit with status 1 on warnings as well as errors")
+	ignore := fs.String("ignore", "", "comma-separated `rules` to skip (e.g., trashed-question,unused-embedded-data)")
+	columns := addColumnFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp lint [flags] <qsf file>...\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	checkStdin(fs.Args()...)
+	opts := options{}
+	columns.apply(&opts)
+	ignored := make(map[string]bool)
+	for _, rule := range strings.Split(*ignore, ",") {
+		ignored[strings.TrimSpace(rule)] = true
+	}
+
+	results := []lintResult{}
+	failed := false
+	for _, qsfPath := range fs.Args() {
+		s, err := lintedSurvey(qsfPath, opts)
+		if err != nil {
+			fatal(err)
+		}
+		for _, issue := range s.Lint() {
+			if ignored[issue.Rule] {
+				continue
+			}
+			results = append(results, lintResult{inputName(qsfPath), issue})
+			if issue.Severity == libsp.LintError || *strict {
+				failed = true
+			}
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fatalf(exitOutput, "Error encoding issues: %s", err)
+		}
+	} else {
+		for _, r := range results {
+			fmt.Fprintf(w, "%s: %s\n", r.File, r.LintIssue)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fatalf(exitOutput, "Error writing to standard output: %s", err)
+	}
+	if failed {
+		os.Exit(exitFindings)
+	}
+}
+
+// lintedSurvey reads a survey and applies the column options and overrides that convert would use,
+// so that lint checks the column names convert would write
+func lintedSurvey(qsfPath string, opts options) (*libsp.Survey, error) {
+	s, err := readQsf(qsfPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = configureColumns(s, opts); err != nil {
+		return nil, err
+	}
+	o, err := readOverrides(qsfPath)
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		for _, w := range o.Validate(s) {
+			log.Printf("Warning: %s", w)
+		}
+		s.ApplyOverrides(o)
+	}
+	return s, nil
+}
@@ -2,120 +2,274 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fflewddur/sp/libsp"
 )
 
+// Exit statuses shared by every command
+const (
+	exitFindings = 1 // lint found problems, or diff found changes
+	exitUsage    = 2 // the command line is invalid
+	exitInput    = 3 // a survey, responses, or overrides file couldn't be read or parsed
+	exitOutput   = 4 // an output file couldn't be written
+)
+
+// command is one of sp's subcommands
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands = []command{
+	{"convert", "convert a survey's responses to CSV and an R script (or SQLite, Parquet, or Excel)", convert},
+	{"inspect", "print sp's interpretation of a survey", inspect},
+	{"codebook", "write a CSV describing each column of the converted data", codebook},
+	{"lint", "check surveys for design problems that make analysis harder", lint},
+	{"stats", "summarize the responses to each column", stats},
+	{"diff", "list the changes between two versions of a survey", diff},
+	{"serve", "offer convert and inspect over HTTP, with an upload page", serve},
+	{"watch", "convert the surveys in a directory again whenever their files change", watch},
+}
+
 func main() {
-	showVer := flag.Bool("v", false, "display version and exit")
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  sp <qsf file> [flags]\n\nFlags:\n")
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+	for _, c := range commands {
+		if os.Args[1] == c.name {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+	switch os.Args[1] {
+	case "-v", "-version", "--version", "version":
+		fmt.Printf("sp version %s\n", libsp.Version)
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		// sp <qsf file> is short for sp convert <qsf file>
+		convert(os.Args[1:])
+	}
+}
 
-		flag.PrintDefaults()
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage:\n  sp <command> [flags] <args>\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.summary)
 	}
-	flag.Parse()
+	fmt.Fprintf(w, "\nRun 'sp <command> -h' for the flags of each command. 'sp <qsf file>' is short for 'sp convert <qsf file>'.\n")
+	fmt.Fprintf(w, "Use - as a file name to read from standard input, or as an output directory to write to standard output.\n")
+	fmt.Fprintf(w, "\nExit status: 0 on success, %d if lint or diff found problems or changes, %d for invalid usage,\n%d if an input file couldn't be read, and %d if output couldn't be written.\n",
+		exitFindings, exitUsage, exitInput, exitOutput)
+}
 
-	if *showVer {
-		fmt.Printf("sp version %s\n", libsp.Version)
-		return
+// fatalf logs a message and exits with the given status
+func fatalf(status int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(status)
+}
+
+// statusError is an error that determines sp's exit status
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+// errorf returns an error that makes sp exit with the given status
+func errorf(status int, format string, v ...interface{}) error {
+	return &statusError{status, fmt.Errorf(format, v...)}
+}
+
+// exitStatus returns the status sp exits with because of err
+func exitStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status
 	}
+	return exitInput
+}
+
+// fatal logs err and exits with its status
+func fatal(err error) {
+	log.Print(err)
+	os.Exit(exitStatus(err))
+}
 
-	args := flag.Args()
-	if len(args) < 1 {
-		flag.Usage()
-		os.Exit(1)
+// parseDate parses a date or date and time given on the command line.
+// If inclusive is true and s has no time, the returned time is the start of the following day,
+// so that responses recorded at any time on that date are included.
+func parseDate(s string, inclusive bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+		if inclusive {
+			t = t.Add(time.Second)
+		}
+		return t, nil
 	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("could not parse '%s' as a date", s)
+	}
+	if inclusive {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
 
-	qsfPath := flag.Args()[0]
-	parseSurvey(qsfPath)
+// openInput opens path for reading; "-" reads standard input
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
 }
 
-func parseSurvey(qsfPath string) {
-	log.Printf("Reading '%s'", qsfPath)
-	qsf, err := os.Open(qsfPath)
+// inputName returns the name used for path in log messages
+func inputName(path string) string {
+	if path == "-" {
+		return "standard input"
+	}
+	return path
+}
+
+// checkStdin exits with a usage error if more than one of paths would read standard input
+func checkStdin(paths ...string) {
+	n := 0
+	for _, p := range paths {
+		if p == "-" {
+			n++
+		}
+	}
+	if n > 1 {
+		fatalf(exitUsage, "Only one input can be read from standard input")
+	}
+}
+
+func readQsf(qsfPath string) (*libsp.Survey, error) {
+	log.Printf("Reading '%s'", inputName(qsfPath))
+	qsf, err := openInput(qsfPath)
 	if err != nil {
-		log.Fatalf("Error reading '%s': %s", qsfPath, err)
+		return nil, errorf(exitInput, "Error reading '%s': %s", inputName(qsfPath), err)
 	}
 	defer qsf.Close()
 
 	qsfReader := bufio.NewReader(qsf)
 	s, err := libsp.ReadQsf(qsfReader)
 	if err != nil {
-		log.Fatalf("Error parsing '%s': %s", qsfPath, err)
+		return nil, errorf(exitInput, "Error parsing '%s': %s", inputName(qsfPath), err)
 	}
+	return s, nil
+}
 
-	xmlPath := buildXMLPath(qsfPath)
-	log.Printf("Reading '%s'", xmlPath)
-	xml, err := os.Open(xmlPath)
-	if err != nil {
-		log.Fatalf("Error reading '%s': %s", xmlPath, err)
+// responsesPath returns the responses file to read for qsfPath: path if it's set, otherwise the XML file next to the QSF file
+func responsesPath(qsfPath, path string) string {
+	if path != "" {
+		return path
 	}
-	defer xml.Close()
-	xmlReader := bufio.NewReader(xml)
-	err = s.ReadXML(xmlReader)
-	if err != nil {
-		log.Fatalf("Error parsing '%s': %s", xmlPath, err)
+	if qsfPath == "-" {
+		fatalf(exitUsage, "-responses is required when the QSF file is read from standard input")
 	}
+	return buildXMLPath(qsfPath)
+}
 
-	// log.Printf("Title = '%s', # of questions = %d, description = '%s'\n", s.Title, len(s.Questions), s.Description)
-	// for _, q := range s.Questions {
-	// log.Printf("ID: %s Wording: %s\n\tChoices: %v", q.ID, q.Wording, q.ResponseChoices())
-	// }
-
-	csvPath := buildCSVPath(qsfPath)
-	log.Printf("Writing '%s'", csvPath)
-	csv, err := os.Create(csvPath)
+// readResponses reads s's responses from path, a Qualtrics XML export or, if it has a .csv extension, a Qualtrics CSV export
+func readResponses(s *libsp.Survey, path string) error {
+	log.Printf("Reading '%s'", inputName(path))
+	f, err := openInput(path)
 	if err != nil {
-		log.Fatalf("Error opening '%s': %s", csvPath, err)
+		return errorf(exitInput, "Error reading '%s': %s", inputName(path), err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if isCSVPath(path) {
+		err = s.ReadCSV(r)
+	} else {
+		err = s.ReadXML(r)
 	}
-	defer csv.Close()
-	w := bufio.NewWriter(csv)
-	err = s.WriteCSV(w)
 	if err != nil {
-		log.Fatalf("Error writing '%s': %s", csvPath, err)
+		return errorf(exitInput, "Error parsing '%s': %s", inputName(path), err)
 	}
+	return nil
+}
 
-	rPath := buildRPath(qsfPath)
-	log.Printf("Writing '%s'", rPath)
-	r, err := os.Create(rPath)
-	if err != nil {
-		log.Fatalf("Error opening '%s': %s", csvPath, err)
+// isCSVPath returns true if path has a .csv extension, in any case
+func isCSVPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".csv")
+}
+
+// overridesFiles are the names of the config files loaded from the directory holding a QSF file, in order of preference
+var overridesFiles = []string{"sp.yaml", "sp.yml", "sp.json"}
+
+// readOverrides reads the overrides file next to qsfPath, returning nil if there isn't one (or the QSF file is read from standard input)
+func readOverrides(qsfPath string) (*libsp.Overrides, error) {
+	if qsfPath == "-" {
+		return nil, nil
 	}
-	defer r.Close()
-	w = bufio.NewWriter(r)
-	err = s.WriteR(w, filepath.Base(csvPath))
-	log.Println("Completed successfully!")
-	if err != nil {
-		log.Fatalf("Error writing '%s': %s", rPath, err)
+	for _, name := range overridesFiles {
+		path := filepath.Join(filepath.Dir(qsfPath), name)
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, errorf(exitInput, "Error reading '%s': %s", path, err)
+		}
+		defer f.Close()
+		log.Printf("Reading '%s'", path)
+		o, err := libsp.ReadOverrides(bufio.NewReader(f))
+		if err != nil {
+			return nil, errorf(exitInput, "Error parsing '%s': %s", path, err)
+		}
+		return o, nil
 	}
+	return nil, nil
 }
 
-func buildXMLPath(qsfPath string) string {
-	i := strings.LastIndex(qsfPath, ".")
-	if i > 0 {
-		qsfPath = qsfPath[:i]
+// outputBase returns the path, without an extension, that output files for qsfPath are named after:
+// the QSF file's base name, in outDir if it's set and otherwise next to the QSF file
+func outputBase(qsfPath, outDir string) string {
+	dir, name := ".", "survey"
+	if qsfPath != "-" {
+		dir = filepath.Dir(qsfPath)
+		name = strings.TrimSuffix(filepath.Base(qsfPath), filepath.Ext(qsfPath))
 	}
-	return qsfPath + ".xml"
+	if outDir != "" {
+		dir = outDir
+	}
+	return filepath.Join(dir, name)
 }
 
-func buildCSVPath(qsfPath string) string {
-	i := strings.LastIndex(qsfPath, ".")
-	if i > 0 {
-		qsfPath = qsfPath[:i]
+// create opens path for writing, creating its directory if needed
+func create(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errorf(exitOutput, "Error creating '%s': %s", filepath.Dir(path), err)
 	}
-	return qsfPath + ".csv"
+	log.Printf("Writing '%s'", path)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errorf(exitOutput, "Error opening '%s': %s", path, err)
+	}
+	return f, nil
 }
 
-func buildRPath(qsfPath string) string {
+func buildXMLPath(qsfPath string) string {
 	i := strings.LastIndex(qsfPath, ".")
 	if i > 0 {
 		qsfPath = qsfPath[:i]
 	}
-	return qsfPath + ".r"
+	return qsfPath + ".xml"
 }
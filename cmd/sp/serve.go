@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// serve offers convert and inspect over HTTP, along with a page for uploading surveys from a browser
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	columns := addColumnFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "listen on this `address`")
+	maxUpload := fs.Int64("max-upload", 64, "reject requests larger than this many `megabytes`")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp serve [flags]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if *maxUpload < 1 {
+		fatalf(exitUsage, "-max-upload must be at least 1")
+	}
+
+	opts := options{}
+	columns.apply(&opts)
+	srv := &server{opts: opts, maxUpload: *maxUpload << 20}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", srv.handleIndex)
+	mux.HandleFunc("/convert", srv.handleConvert)
+	mux.HandleFunc("/inspect", srv.handleInspect)
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Allow time for large uploads and conversions, but don't let slow clients hold connections forever
+		ReadTimeout:  5 * time.Minute,
+		WriteTimeout: 5 * time.Minute,
+		IdleTimeout:  time.Minute,
+	}
+	log.Printf("Listening on http://%s", *addr)
+	if err := hs.ListenAndServe(); err != nil {
+		fatalf(exitOutput, "Error serving on '%s': %s", *addr, err)
+	}
+}
+
+// server handles sp serve's HTTP requests
+type server struct {
+	opts      options // column options applied to every survey
+	maxUpload int64   // largest request body accepted, in bytes
+}
+
+// maxUploadMemory is how much of an upload is kept in memory; the rest is written to temporary files
+const maxUploadMemory = 8 << 20
+
+// httpError is an error with the HTTP status to respond with
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func (srv *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, uploadPage)
+}
+
+// handleConvert responds with a zip archive holding the CSV, R script, and codebook for the uploaded survey and responses
+func (srv *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if !checkPost(w, r) {
+		return
+	}
+	s, name, warnings, err := srv.readUpload(w, r, true)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var b bytes.Buffer
+	if err = writeZip(&b, s, name, warnings); err != nil {
+		writeError(w, r, &httpError{http.StatusInternalServerError, fmt.Sprintf("could not write archive: %s", err)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	w.Write(b.Bytes())
+	log.Printf("%s %s: converted '%s' (%d responses)", r.Method, r.URL.Path, name, len(s.Responses))
+}
+
+// handleInspect responds with the uploaded survey, and its responses if they were uploaded too, as JSON
+func (srv *server) handleInspect(w http.ResponseWriter, r *http.Request) {
+	if !checkPost(w, r) {
+		return
+	}
+	s, name, _, err := srv.readUpload(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteJSON(bufio.NewWriter(&b)); err != nil {
+		writeError(w, r, &httpError{http.StatusInternalServerError, err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b.Bytes())
+	log.Printf("%s %s: inspected '%s'", r.Method, r.URL.Path, name)
+}
+
+func checkPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, &httpError{http.StatusMethodNotAllowed, "use POST with a multipart/form-data body"})
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadRequest
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+	log.Printf("%s %s: %s", r.Method, r.URL.Path, err)
+	http.Error(w, err.Error(), status)
+}
+
+// readUpload parses the survey in the request's "qsf" file, reading responses from its "responses" file and applying
+// overrides from its "overrides" file. The responses file is required if needResponses is true; the overrides file is optional.
+// It returns the survey, the name to give its output files, and warnings about its scores, overrides, and column names.
+func (srv *server) readUpload(w http.ResponseWriter, r *http.Request, needResponses bool) (*libsp.Survey, string, []string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, srv.maxUpload)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, "", nil, &httpError{http.StatusRequestEntityTooLarge, fmt.Sprintf("upload is larger than %d MB", srv.maxUpload>>20)}
+		}
+		return nil, "", nil, &httpError{http.StatusBadRequest, fmt.Sprintf("could not parse form: %s", err)}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	qsf, header, err := r.FormFile("qsf")
+	if err != nil {
+		return nil, "", nil, &httpError{http.StatusBadRequest, "missing 'qsf' file"}
+	}
+	defer qsf.Close()
+	s, err := libsp.ReadQsf(bufio.NewReader(qsf))
+	if err != nil {
+		return nil, "", nil, &httpError{http.StatusUnprocessableEntity, fmt.Sprintf("could not parse QSF file: %s", err)}
+	}
+	if err = configureColumns(s, srv.opts); err != nil {
+		return nil, "", nil, &httpError{http.StatusInternalServerError, err.Error()}
+	}
+
+	warnings := []string{}
+	responses, err := formFile(r, "responses")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if responses != nil {
+		defer responses.Close()
+		if err = s.ReadXML(bufio.NewReader(responses)); err != nil {
+			return nil, "", nil, &httpError{http.StatusUnprocessableEntity, fmt.Sprintf("could not parse responses file: %s", err)}
+		}
+		warnings = append(warnings, s.ScoreMismatches()...)
+	} else if needResponses {
+		return nil, "", nil, &httpError{http.StatusBadRequest, "missing 'responses' file"}
+	}
+
+	overrides, err := formFile(r, "overrides")
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if overrides != nil {
+		defer overrides.Close()
+		o, err := libsp.ReadOverrides(bufio.NewReader(overrides))
+		if err != nil {
+			return nil, "", nil, &httpError{http.StatusUnprocessableEntity, fmt.Sprintf("could not parse overrides file: %s", err)}
+		}
+		warnings = append(warnings, o.Validate(s)...)
+		s.ApplyOverrides(o)
+	}
+	warnings = append(warnings, s.RenamedColumns()...)
+	return s, uploadName(header.Filename), warnings, nil
+}
+
+// formFile returns the request's file with the given field name, or nil if it wasn't uploaded
+func formFile(r *http.Request, field string) (multipart.File, error) {
+	f, header, err := r.FormFile(field)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &httpError{http.StatusBadRequest, fmt.Sprintf("could not read '%s' file: %s", field, err)}
+	}
+	if header.Size == 0 {
+		// Browsers send an empty part for file inputs left blank
+		f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
+
+// uploadName returns the base name, without an extension, of an uploaded file; clients may send full paths
+func uploadName(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+	if name == "" || name == "." || name == "/" {
+		return "survey"
+	}
+	return name
+}
+
+// zipEntry is a file in the archive returned by /convert
+type zipEntry struct {
+	name  string
+	write func(*bufio.Writer) error
+}
+
+// writeZip writes an archive holding s's CSV, R script, and codebook, plus any warnings, named after name
+func writeZip(w io.Writer, s *libsp.Survey, name string, warnings []string) error {
+	zw := zip.NewWriter(w)
+	files := []zipEntry{
+		{name + ".csv", s.WriteCSV},
+		{name + ".r", func(bw *bufio.Writer) error { return s.WriteR(bw, name+".csv") }},
+		{name + "_codebook.csv", s.WriteCodebook},
+	}
+	if len(warnings) > 0 {
+		files = append(files, zipEntry{"warnings.txt", func(bw *bufio.Writer) error {
+			_, err := bw.WriteString(strings.Join(warnings, "\n") + "\n")
+			return err
+		}})
+	}
+	now := time.Now()
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(fw)
+		if err = f.write(bw); err != nil {
+			return fmt.Errorf("could not write %s: %s", f.name, err)
+		}
+		if err = bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+const uploadPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>sp</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+fieldset { margin-bottom: 1.5em; }
+label { display: block; margin: 0.5em 0; }
+</style>
+</head>
+<body>
+<h1>sp</h1>
+<form action="/convert" method="post" enctype="multipart/form-data">
+<fieldset>
+<legend>Convert responses</legend>
+<p>Download a zip archive with a CSV of the responses, an R script to import it, and a codebook.</p>
+<label>Survey (QSF): <input type="file" name="qsf" accept=".qsf" required></label>
+<label>Responses (XML): <input type="file" name="responses" accept=".xml" required></label>
+<label>Overrides (optional sp.yaml or sp.json): <input type="file" name="overrides" accept=".yaml,.yml,.json"></label>
+<button type="submit">Convert</button>
+</fieldset>
+</form>
+<form action="/inspect" method="post" enctype="multipart/form-data">
+<fieldset>
+<legend>Inspect a survey</legend>
+<p>View sp's interpretation of the survey as JSON.</p>
+<label>Survey (QSF): <input type="file" name="qsf" accept=".qsf" required></label>
+<label>Responses (optional XML): <input type="file" name="responses" accept=".xml"></label>
+<button type="submit">Inspect</button>
+</fieldset>
+</form>
+</body>
+</html>
+`
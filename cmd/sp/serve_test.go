@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+const serveTestXML = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<progress>100</progress>
+		<duration>10</duration>
+		<finished>True</finished>
+		<recordedDate>2020-11-09 13:12:11</recordedDate>
+		<_recordId>R_1</_recordId>
+		<QID1>Red</QID1>
+		<QID2_TEXT>Nothing</QID2_TEXT>
+	</Response>
+</Responses>`
+
+// serveTestQsf returns a small survey to upload, as a QSF file
+func serveTestQsf(t *testing.T) []byte {
+	s := libsp.NewSurvey("Upload")
+	b := s.AddBlock("Main")
+	if _, err := s.AddQuestion(b, libsp.MultipleChoiceSingleResponse, "Pick one", "Red", "Green"); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+	if _, err := s.AddQuestion(b, libsp.TextEntry, "Anything else?"); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := s.WriteQsf(w); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// uploadRequest returns a POST request to path with a multipart/form-data body holding files, keyed by field name
+func uploadRequest(t *testing.T, path string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for field, content := range files {
+		fw, err := mw.CreateFormFile(field, "survey."+field)
+		if err != nil {
+			t.Fatalf("err = %s", err)
+		}
+		fw.Write(content)
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestServeConvert(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	qsf := serveTestQsf(t)
+	tests := []struct {
+		name      string
+		method    string
+		files     map[string][]byte
+		maxUpload int64
+		status    int
+		want      []string // the files in the returned archive
+	}{
+		{"converts", http.MethodPost, map[string][]byte{"qsf": qsf, "responses": []byte(serveTestXML)}, 1 << 20, http.StatusOK,
+			[]string{"survey.csv", "survey.r", "survey_codebook.csv"}},
+		{"needs responses", http.MethodPost, map[string][]byte{"qsf": qsf}, 1 << 20, http.StatusBadRequest, nil},
+		{"needs a survey", http.MethodPost, map[string][]byte{"responses": []byte(serveTestXML)}, 1 << 20, http.StatusBadRequest, nil},
+		{"rejects bad surveys", http.MethodPost, map[string][]byte{"qsf": []byte("{"), "responses": []byte(serveTestXML)}, 1 << 20, http.StatusUnprocessableEntity, nil},
+		{"limits upload size", http.MethodPost, map[string][]byte{"qsf": qsf, "responses": []byte(serveTestXML)}, 100, http.StatusRequestEntityTooLarge, nil},
+		{"needs POST", http.MethodGet, nil, 1 << 20, http.StatusMethodNotAllowed, nil},
+	}
+	for _, test := range tests {
+		srv := &server{maxUpload: test.maxUpload}
+		r := uploadRequest(t, "/convert", test.files)
+		r.Method = test.method
+		w := httptest.NewRecorder()
+		srv.handleConvert(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: status = %d; want %d (%s)", test.name, w.Code, test.status, strings.TrimSpace(w.Body.String()))
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+		if err != nil {
+			t.Errorf("%s: err = %s", test.name, err)
+			continue
+		}
+		got := []string{}
+		for _, f := range zr.File {
+			got = append(got, f.Name)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ", ") != strings.Join(test.want, ", ") {
+			t.Errorf("%s: archive files = %v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestServeInspect(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	srv := &server{maxUpload: 1 << 20}
+	w := httptest.NewRecorder()
+	srv.handleInspect(w, uploadRequest(t, "/inspect", map[string][]byte{"qsf": serveTestQsf(t)}))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d; want %d (%s)", w.Code, http.StatusOK, strings.TrimSpace(w.Body.String()))
+		return
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %s; want application/json", got)
+	}
+	if !strings.Contains(w.Body.String(), "Pick one") {
+		t.Errorf("body = %s; want the survey's questions", w.Body.String())
+	}
+}
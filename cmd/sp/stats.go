@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// stats summarizes the responses to each column that convert would write, as a table or JSON
+func stats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	columns := addColumnFlags(fs)
+	filters := addFilterFlags(fs)
+	asJSON := fs.Bool("json", false, "print the summaries as a JSON array")
+	responses := fs.String("responses", "", "read responses from this XML or CSV `file` (default: the QSF file's name with an .xml extension)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n  sp stats [flags] <qsf file>\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	opts := options{}
+	columns.apply(&opts)
+	filters.apply(&opts)
+	qsfPath := fs.Arg(0)
+	xmlPath := responsesPath(qsfPath, *responses)
+	checkStdin(qsfPath, xmlPath)
+	s, warnings, err := loadSurvey(qsfPath, xmlPath, opts)
+	if err != nil {
+		fatal(err)
+	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s", w)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	if *asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s.Stats()); err != nil {
+			fatalf(exitOutput, "Error encoding stats: %s", err)
+		}
+	} else {
+		printStats(w, s)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf(exitOutput, "Error writing to standard output: %s", err)
+	}
+}
+
+func printStats(w *bufio.Writer, s *libsp.Survey) {
+	finished := 0
+	for _, r := range s.Responses {
+		if r.Finished {
+			finished++
+		}
+	}
+	fmt.Fprintf(w, "%s (%s)\n%d responses, %d finished\n\n", s.Title, s.ID, len(s.Responses), finished)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "column\ttype\tanswered\tmissing\tsummary")
+	for _, cs := range s.Stats() {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", cs.Column, cs.Type, cs.Answered, cs.Missing, statsSummary(cs))
+	}
+	tw.Flush()
+}
+
+// statsSummary describes the values in a column: the count of each level, the range and mean of numbers, or the number of different values
+func statsSummary(cs libsp.ColumnStats) string {
+	switch {
+	case len(cs.Counts) > 0:
+		counts := []string{}
+		for _, c := range cs.Counts {
+			counts = append(counts, fmt.Sprintf("%s: %d", c.Level, c.N))
+		}
+		return strings.Join(counts, "; ")
+	case cs.Mean != nil:
+		return fmt.Sprintf("min %g, mean %.2f, max %g", *cs.Min, *cs.Mean, *cs.Max)
+	case cs.Type == "character":
+		return fmt.Sprintf("%d distinct", cs.Distinct)
+	}
+	return ""
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fflewddur/sp/libsp"
+)
+
+// watch converts the surveys in a directory whenever their QSF, responses, or overrides files change.
+// Responses are read from each QSF file's XML export, or its CSV export if it has no XML export.
+func watch(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	columns := addColumnFlags(flags)
+	filters := addFilterFlags(flags)
+	format := flags.String("format", "csv", "output `format`: csv (CSV and R script), sqlite, parquet, or xlsx")
+	long := flags.Bool("long", false, "also write responses in long format (one row per respondent and question column)")
+	interval := flags.Duration("interval", time.Second, "check for changes this `often`")
+	delay := flags.Duration("delay", 2*time.Second, "convert once changed files have stayed the same for this `long`")
+	var outDir string
+	flags.StringVar(&outDir, "o", "", "write output files to this `directory`, mirroring the watched directory's structure (default: each QSF file's directory)")
+	flags.StringVar(&outDir, "out-dir", "", "same as -o")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage:\n  sp watch [flags] <directory>\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	opts := options{long: *long, format: *format, outDir: outDir}
+	columns.apply(&opts)
+	filters.apply(&opts)
+	switch opts.format {
+	case "csv", "sqlite", "parquet", "xlsx":
+	default:
+		fatalf(exitUsage, "Unknown output format '%s'", opts.format)
+	}
+	if opts.outDir == "-" {
+		fatalf(exitUsage, "sp watch can't write to standard output")
+	}
+	if *interval <= 0 || *delay < 0 {
+		fatalf(exitUsage, "-interval must be positive and -delay can't be negative")
+	}
+	root := flags.Arg(0)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fatalf(exitInput, "'%s' is not a directory", root)
+	}
+
+	w := newWatcher(root, opts, *delay)
+	log.Printf("Watching '%s' for changes; press Ctrl-C to stop", root)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		w.poll(time.Now())
+		<-ticker.C
+	}
+}
+
+// watchedFile is the state of a file the last time watcher looked at it
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	changed time.Time // when the watcher noticed the file's size or modification time change
+}
+
+// watcher polls a directory tree for changes to surveys, converting each one once its files have stopped changing
+type watcher struct {
+	root      string
+	opts      options
+	delay     time.Duration
+	files     map[string]watchedFile     // nil until the first poll
+	pending   map[string]bool            // QSF files to convert once their files settle
+	responses map[string]map[string]bool // IDs of each survey's responses at its last conversion
+
+	scan    func() (map[string]watchedFile, error) // returns the current state of the watched files
+	convert func(qsfPath string)                   // converts a survey whose files have settled
+}
+
+func newWatcher(root string, opts options, delay time.Duration) *watcher {
+	w := &watcher{
+		root:      root,
+		opts:      opts,
+		delay:     delay,
+		pending:   make(map[string]bool),
+		responses: make(map[string]map[string]bool),
+	}
+	w.scan = w.scanRoot
+	w.convert = w.reconvert
+	return w
+}
+
+// poll looks for changed files and converts the surveys whose files have settled.
+// Files present at the first poll count as settled, so every survey is converted when sp starts.
+func (w *watcher) poll(now time.Time) {
+	files, err := w.scan()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	first := w.files == nil
+	for path, f := range files {
+		old, ok := w.files[path]
+		if ok && old.size == f.size && old.modTime.Equal(f.modTime) {
+			files[path] = old
+			continue
+		}
+		if !first {
+			f.changed = now
+			files[path] = f
+			if ok {
+				log.Printf("'%s' changed", path)
+			} else {
+				log.Printf("'%s' was added", path)
+			}
+		}
+		w.markPending(path, files)
+	}
+	w.files = files
+
+	for qsfPath := range w.pending {
+		if _, ok := files[qsfPath]; !ok {
+			delete(w.pending, qsfPath)
+			delete(w.responses, qsfPath)
+			continue
+		}
+		if w.settled(qsfPath, now) {
+			delete(w.pending, qsfPath)
+			w.convert(qsfPath)
+		}
+	}
+}
+
+// scanRoot returns the QSF, XML, Qualtrics CSV, and overrides files in the watched directory and its subdirectories
+func (w *watcher) scanRoot() (map[string]watchedFile, error) {
+	files := make(map[string]watchedFile)
+	err := filepath.WalkDir(w.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isWatched(path) {
+			return nil
+		}
+		if isCSVPath(path) && !isQualtricsCSV(path) {
+			// sp's own output, or an export that's still being written
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			// Removed since the directory was read
+			return nil
+		} else if err != nil {
+			return err
+		}
+		files[path] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, errorf(exitInput, "Error searching '%s': %s", w.root, err)
+	}
+	return files, nil
+}
+
+// isWatched returns true if changes to path can change a survey's output.
+// CSV files are only responses if they're Qualtrics exports; scanRoot skips the CSV files sp writes itself.
+func isWatched(path string) bool {
+	if isSurveyFile(path) || isCSVPath(path) {
+		return true
+	}
+	for _, name := range overridesFiles {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// markPending marks the surveys that use path for conversion
+func (w *watcher) markPending(path string, files map[string]watchedFile) {
+	for qsfPath := range files {
+		if !strings.EqualFold(filepath.Ext(qsfPath), ".qsf") {
+			continue
+		}
+		if path == qsfPath || path == buildXMLPath(qsfPath) || path == buildCSVPath(qsfPath) ||
+			(!isSurveyFile(path) && !isCSVPath(path) && filepath.Dir(path) == filepath.Dir(qsfPath)) {
+			w.pending[qsfPath] = true
+		}
+	}
+}
+
+// isSurveyFile returns true if path is a QSF or XML file rather than an overrides file
+func isSurveyFile(path string) bool {
+	ext := filepath.Ext(path)
+	return strings.EqualFold(ext, ".qsf") || strings.EqualFold(ext, ".xml")
+}
+
+// isQualtricsCSV returns true if path is a CSV file exported from Qualtrics, rather than, for example, a CSV file written by sp
+func isQualtricsCSV(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return libsp.IsQualtricsCSV(bufio.NewReader(f))
+}
+
+// buildCSVPath returns the path of the Qualtrics CSV export of qsfPath's responses, the QSF file's name with a .csv extension
+func buildCSVPath(qsfPath string) string {
+	return strings.TrimSuffix(buildXMLPath(qsfPath), ".xml") + ".csv"
+}
+
+// responsesPath returns the responses file for qsfPath: its XML export if there is one, otherwise its CSV export,
+// or "" if it has neither
+func (w *watcher) responsesPath(qsfPath string) string {
+	for _, path := range []string{buildXMLPath(qsfPath), buildCSVPath(qsfPath)} {
+		if _, ok := w.files[path]; ok {
+			return path
+		}
+	}
+	return ""
+}
+
+// settled returns true if qsfPath has a responses file, and neither it nor the other files it uses have changed for the watcher's delay.
+// Waiting for files to stay the same avoids reading an export that's still being written.
+func (w *watcher) settled(qsfPath string, now time.Time) bool {
+	responses := w.responsesPath(qsfPath)
+	if responses == "" {
+		return false
+	}
+	paths := []string{qsfPath, responses}
+	for _, name := range overridesFiles {
+		paths = append(paths, filepath.Join(filepath.Dir(qsfPath), name))
+	}
+	for _, path := range paths {
+		if f, ok := w.files[path]; ok && now.Sub(f.changed) < w.delay {
+			return false
+		}
+	}
+	return true
+}
+
+// reconvert converts one survey, logging how its responses changed since it was last converted
+func (w *watcher) reconvert(qsfPath string) {
+	base, err := surveyBase(w.root, w.opts.outDir, qsfPath)
+	if err != nil {
+		log.Printf("Error converting '%s': %s", qsfPath, err)
+		return
+	}
+	responses := w.responsesPath(qsfPath)
+	if w.opts.format == "csv" && filepath.Clean(base+".csv") == filepath.Clean(responses) {
+		log.Printf("Error converting '%s': its output would replace the responses in '%s'; use -o to write it to another directory", qsfPath, responses)
+		return
+	}
+	s, warnings, err := loadSurvey(qsfPath, responses, w.opts)
+	if err != nil {
+		log.Printf("%s; waiting for it to change", err)
+		return
+	}
+	for _, warning := range warnings {
+		log.Printf("Warning: %s: %s", qsfPath, warning)
+	}
+	if err = writeSurvey(s, base, w.opts); err != nil {
+		log.Print(err)
+		return
+	}
+
+	ids := make(map[string]bool)
+	for _, r := range s.Responses {
+		ids[r.ID] = true
+	}
+	old, ok := w.responses[qsfPath]
+	w.responses[qsfPath] = ids
+	if !ok {
+		log.Printf("Converted '%s': %d responses", qsfPath, len(ids))
+		return
+	}
+	added, removed := 0, 0
+	for id := range ids {
+		if !old[id] {
+			added++
+		}
+	}
+	for id := range old {
+		if !ids[id] {
+			removed++
+		}
+	}
+	log.Printf("Converted '%s': %d responses (%d new, %d removed since the last run)", qsfPath, len(ids), added, removed)
+}
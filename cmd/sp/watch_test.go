@@ -0,0 +1,226 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	qsf := filepath.Join("a", "survey.qsf")
+	xml := filepath.Join("a", "survey.xml")
+	csv := filepath.Join("a", "survey.csv")
+	yaml := filepath.Join("a", "sp.yaml")
+	otherQsf := filepath.Join("b", "other.qsf")
+	otherXML := filepath.Join("b", "other.xml")
+
+	type step struct {
+		at    time.Duration          // time since the first poll
+		files map[string]watchedFile // the watched files at this poll
+		want  []string               // the surveys this poll converts
+	}
+	// Versions of a file are told apart by size, since poll compares sizes and modification times
+	size := func(n int64) watchedFile { return watchedFile{size: n} }
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"existing surveys convert at once", []step{
+			{0, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(1), otherXML: size(1)}, []string{qsf, otherQsf}},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(1), otherXML: size(1)}, nil},
+		}},
+		{"waits for responses", []step{
+			{0, map[string]watchedFile{qsf: size(1)}, nil},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(1)}, nil},
+			{2500 * time.Millisecond, map[string]watchedFile{qsf: size(1), xml: size(1)}, nil},
+			{3 * time.Second, map[string]watchedFile{qsf: size(1), xml: size(1)}, []string{qsf}},
+		}},
+		{"waits for changes to stop", []step{
+			{0, map[string]watchedFile{qsf: size(1), xml: size(1)}, []string{qsf}},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(2)}, nil},
+			{2 * time.Second, map[string]watchedFile{qsf: size(1), xml: size(3)}, nil},
+			{3500 * time.Millisecond, map[string]watchedFile{qsf: size(1), xml: size(3)}, nil},
+			{4 * time.Second, map[string]watchedFile{qsf: size(1), xml: size(3)}, []string{qsf}},
+		}},
+		{"changed QSF", []step{
+			{0, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(1), otherXML: size(1)}, []string{qsf, otherQsf}},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(2), otherXML: size(1)}, nil},
+			{3 * time.Second, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(2), otherXML: size(1)}, []string{otherQsf}},
+		}},
+		{"overrides apply to surveys in the same directory", []step{
+			{0, map[string]watchedFile{qsf: size(1), xml: size(1), otherQsf: size(1), otherXML: size(1)}, []string{qsf, otherQsf}},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(1), yaml: size(1), otherQsf: size(1), otherXML: size(1)}, nil},
+			{3 * time.Second, map[string]watchedFile{qsf: size(1), xml: size(1), yaml: size(1), otherQsf: size(1), otherXML: size(1)}, []string{qsf}},
+		}},
+		{"CSV responses", []step{
+			{0, map[string]watchedFile{qsf: size(1)}, nil},
+			{time.Second, map[string]watchedFile{qsf: size(1), csv: size(1)}, nil},
+			{3 * time.Second, map[string]watchedFile{qsf: size(1), csv: size(1)}, []string{qsf}},
+			{4 * time.Second, map[string]watchedFile{qsf: size(1), csv: size(2)}, nil},
+			{6 * time.Second, map[string]watchedFile{qsf: size(1), csv: size(2)}, []string{qsf}},
+		}},
+		{"removed surveys", []step{
+			{0, map[string]watchedFile{qsf: size(1), xml: size(1)}, []string{qsf}},
+			{time.Second, map[string]watchedFile{qsf: size(1), xml: size(2)}, nil},
+			{2 * time.Second, map[string]watchedFile{xml: size(2)}, nil},
+			{5 * time.Second, map[string]watchedFile{xml: size(2)}, nil},
+		}},
+	}
+	for _, test := range tests {
+		w := newWatcher(".", options{}, 2*time.Second)
+		var files map[string]watchedFile
+		var got []string
+		w.scan = func() (map[string]watchedFile, error) {
+			// poll keeps the map it's given, so return a copy
+			copied := make(map[string]watchedFile)
+			for path, f := range files {
+				copied[path] = f
+			}
+			return copied, nil
+		}
+		w.convert = func(qsfPath string) { got = append(got, qsfPath) }
+
+		start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, s := range test.steps {
+			files = s.files
+			got = nil
+			w.poll(start.Add(s.at))
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(s.want, ",") {
+				t.Errorf("%s: step %d converted %v; want %v", test.name, i, got, s.want)
+			}
+		}
+		if len(w.pending) > 0 {
+			t.Errorf("%s: pending = %v; want none", test.name, w.pending)
+		}
+	}
+}
+
+func TestWatcherSettled(t *testing.T) {
+	qsf := filepath.Join("a", "survey.qsf")
+	xml := filepath.Join("a", "survey.xml")
+	csv := filepath.Join("a", "survey.csv")
+	yaml := filepath.Join("a", "sp.yaml")
+	otherYaml := filepath.Join("b", "sp.yaml")
+	now := time.Date(2020, 1, 1, 0, 0, 10, 0, time.UTC)
+	changed := func(ago time.Duration) watchedFile { return watchedFile{changed: now.Add(-ago)} }
+
+	tests := []struct {
+		name  string
+		files map[string]watchedFile
+		want  bool
+	}{
+		{"no responses", map[string]watchedFile{qsf: changed(time.Minute)}, false},
+		{"unchanged", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(time.Minute)}, true},
+		{"never changed", map[string]watchedFile{qsf: {}, xml: {}}, true},
+		{"QSF changed", map[string]watchedFile{qsf: changed(time.Second), xml: changed(time.Minute)}, false},
+		{"responses changed", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(time.Second)}, false},
+		{"responses changed at the delay", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(2 * time.Second)}, true},
+		{"CSV responses", map[string]watchedFile{qsf: changed(time.Minute), csv: changed(time.Minute)}, true},
+		{"CSV responses changed", map[string]watchedFile{qsf: changed(time.Minute), csv: changed(time.Second)}, false},
+		{"XML responses preferred to CSV", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(time.Minute), csv: changed(time.Second)}, true},
+		{"overrides changed", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(time.Minute), yaml: changed(time.Second)}, false},
+		{"other directory's overrides changed", map[string]watchedFile{qsf: changed(time.Minute), xml: changed(time.Minute), otherYaml: changed(time.Second)}, true},
+	}
+	for _, test := range tests {
+		w := newWatcher(".", options{}, 2*time.Second)
+		w.files = test.files
+		if got := w.settled(qsf, now); got != test.want {
+			t.Errorf("%s: settled() = %t; want %t", test.name, got, test.want)
+		}
+	}
+}
+
+// qualtricsCSVExport is the start of a Qualtrics CSV export, with each column's ImportId in its third header row
+const qualtricsCSVExport = "\xef\xbb\xbfResponseId,Q1\nResponse ID,Pick one\n" +
+	`"{""ImportId"":""_recordId""}","{""ImportId"":""QID1""}"` + "\nR_1,Red\n"
+
+func TestWatcherScanRoot(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		filepath.Join("a", "survey.qsf"):         "{}",
+		filepath.Join("a", "survey.csv"):         qualtricsCSVExport,
+		filepath.Join("a", "sp.yaml"):            "",
+		filepath.Join("a", "notes.txt"):          "",
+		filepath.Join("b", "other.QSF"):          "{}",
+		filepath.Join("b", "other.xml"):          "<Responses/>",
+		filepath.Join("b", "other.csv"):          "id,q1\nR_1,Red\n",
+		filepath.Join("b", "other_codebook.csv"): "column,label\nq1,Pick one\n",
+		filepath.Join("c", "partial.csv"):        "ResponseId,Q1\n",
+		filepath.Join("c", "sp.json"):            "{}",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err = %s", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("err = %s", err)
+		}
+	}
+
+	w := newWatcher(root, options{}, 0)
+	scanned, err := w.scanRoot()
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	got := []string{}
+	for path := range scanned {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{"a/sp.yaml", "a/survey.csv", "a/survey.qsf", "b/other.QSF", "b/other.xml", "c/sp.json"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("scanRoot() = %v; want %v", got, want)
+	}
+}
+
+func TestWatcherReconvertCSV(t *testing.T) {
+	var logged strings.Builder
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	root := t.TempDir()
+	qsf := filepath.Join(root, "survey.qsf")
+	csv := filepath.Join(root, "survey.csv")
+	if err := os.WriteFile(qsf, serveTestQsf(t), 0644); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+	if err := os.WriteFile(csv, []byte(qualtricsCSVExport), 0644); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+
+	// Writing CSV output beside the export would replace it
+	w := newWatcher(root, options{format: "csv"}, 0)
+	w.files = map[string]watchedFile{qsf: {}, csv: {}}
+	w.reconvert(qsf)
+	if !strings.Contains(logged.String(), "would replace the responses") {
+		t.Errorf("reconvert() logged %q; want an error about replacing the responses", logged.String())
+	}
+	if b, err := os.ReadFile(csv); err != nil || string(b) != qualtricsCSVExport {
+		t.Errorf("reconvert() changed '%s'", csv)
+	}
+
+	// With -o, the export is read like an XML export
+	logged.Reset()
+	outDir := t.TempDir()
+	w = newWatcher(root, options{format: "csv", outDir: outDir}, 0)
+	w.files = map[string]watchedFile{qsf: {}, csv: {}}
+	w.reconvert(qsf)
+	if !strings.Contains(logged.String(), "Converted '"+qsf+"': 1 responses") {
+		t.Errorf("reconvert() logged %q; want 1 converted response", logged.String())
+	}
+	if b, err := os.ReadFile(filepath.Join(outDir, "survey.csv")); err != nil || !strings.Contains(string(b), "R_1") {
+		t.Errorf("reconvert() output = %q, err = %v; want the CSV export's response", b, err)
+	}
+}
@@ -0,0 +1,404 @@
+package libsp
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var reQID = regexp.MustCompile(`^QID(\d+)$`)
+
+// qsfQuestionTypes maps the question types the builder supports to Qualtrics' QuestionType, Selector, and SubSelector
+var qsfQuestionTypes = map[QType][3]string{
+	Description:                  {"DB", "TB", ""},
+	MultipleChoiceSingleResponse: {"MC", "SAVR", "TX"},
+	MultipleChoiceMultiResponse:  {"MC", "MAVR", "TX"},
+	MatrixSingleResponse:         {"Matrix", "Likert", "SingleAnswer"},
+	MatrixMultiResponse:          {"Matrix", "Likert", "MultipleAnswer"},
+	ConstantSum:                  {"CS", "VRTL", ""},
+	RankOrder:                    {"RO", "DND", "TX"},
+	TextEntry:                    {"TE", "SL", ""},
+	Timing:                       {"Timing", "PageTimer", ""},
+}
+
+// NewSurvey returns an empty survey with the given title. Add content with AddBlock, AddQuestion, and AddEmbeddedData,
+// arrange the survey flow with AddRandomizer, AddBranch, and AddEmbeddedDataElement,
+// then save it with WriteQsf to import it into Qualtrics.
+func NewSurvey(title string) *Survey {
+	now := time.Now().UTC().Truncate(time.Second)
+	s := &Survey{
+		ID:         newQualtricsID("SV_"),
+		Title:      title,
+		Status:     "Inactive",
+		Language:   "EN",
+		CreatedOn:  now,
+		ModifiedOn: now,
+		Questions:  make(map[string]*Question),
+		blocks:     make(map[string]*block),
+	}
+	trash := &block{Type: "Trash", ID: newQualtricsID("BL_"), Description: "Trash / Unused Questions"}
+	s.blocks[trash.ID] = trash
+
+	element := func(element, primary string, secondary interface{}, payload interface{}) qsfObject {
+		return qsfObject{"SurveyID": s.ID, "Element": element, "PrimaryAttribute": primary, "SecondaryAttribute": secondary, "TertiaryAttribute": nil, "Payload": payload}
+	}
+	s.qsfDoc = qsfObject{
+		"SurveyEntry": qsfObject{
+			"SurveyID":             s.ID,
+			"SurveyName":           title,
+			"SurveyDescription":    nil,
+			"SurveyLanguage":       s.Language,
+			"SurveyStatus":         s.Status,
+			"SurveyStartDate":      "0000-00-00 00:00:00",
+			"SurveyExpirationDate": "0000-00-00 00:00:00",
+			"SurveyCreationDate":   now.Format(timeFormat),
+			"LastModified":         now.Format(timeFormat),
+			"LastAccessed":         "0000-00-00 00:00:00",
+			"LastActivated":        "0000-00-00 00:00:00",
+			"Deleted":              nil,
+		},
+		"SurveyElements": []interface{}{
+			element("BL", "Survey Blocks", nil, []interface{}{
+				qsfObject{"Type": trash.Type, "Description": trash.Description, "ID": trash.ID, "BlockElements": []interface{}{}},
+			}),
+			element("FL", "Survey Flow", nil, qsfObject{
+				"Type": "Root", "FlowID": "FL_1", "Flow": []interface{}{}, "Properties": qsfObject{"Count": 1},
+			}),
+			element("SO", "Survey Options", nil, qsfObject{
+				"BackButton": "false", "SaveAndContinue": "true", "SurveyProtection": "PublicSurvey", "BallotBoxStuffingPrevention": "false",
+				"NoIndex": "Yes", "SecureResponseFiles": "true", "SurveyExpiration": "None", "SurveyTermination": "DefaultMessage",
+				"Header": "", "Footer": "", "ProgressBarDisplay": "None", "PartialData": "+1 week", "NewScoring": 1, "SurveyTitle": title,
+			}),
+			element("QC", "Survey Question Count", "0", nil),
+		},
+	}
+	s.original = s.snapshot()
+	return s
+}
+
+// AddBlock appends a new block with the given description to the end of the survey flow and returns its ID
+func (s *Survey) AddBlock(description string) string {
+	b := &block{Type: "Standard", ID: newQualtricsID("BL_"), Description: description}
+	if len(s.blockOrder) == 0 {
+		b.Type = "Default"
+	}
+	s.blocks[b.ID] = b
+	embeddedDataIDs := s.embeddedDataIDs()
+	s.blockOrder = append(s.blockOrder, b.ID)
+	s.sortQuestions()
+	s.addEmbeddedData(embeddedDataIDs)
+	return b.ID
+}
+
+// AddQuestion appends a new question to the given block, with the next unused question ID and a matching export tag (e.g., QID4 and Q4).
+// For multiple choice and rank order questions, choices are the response choices; for matrix and constant sum questions, they're the statements
+// (add a matrix's scale points with Question.AddChoice).
+func (s *Survey) AddQuestion(blockID string, qt QType, wording string, choices ...string) (*Question, error) {
+	b, ok := s.blocks[blockID]
+	if !ok || b.Type == "Trash" {
+		return nil, fmt.Errorf("no block with ID '%s'", blockID)
+	}
+	if _, ok := qsfQuestionTypes[qt]; !ok {
+		return nil, fmt.Errorf("cannot build %s questions", qt)
+	}
+	if len(choices) > 0 && (qt == Description || qt == TextEntry || qt == Timing) {
+		return nil, fmt.Errorf("%s questions don't have choices", qt)
+	}
+
+	n := s.nextQuestionNumber()
+	q := &Question{
+		ID:            fmt.Sprintf("QID%d", n),
+		Wording:       wording,
+		qType:         qt,
+		dataExportTag: fmt.Sprintf("Q%d", n),
+	}
+	built := make([]Choice, len(choices))
+	for i, label := range choices {
+		id := strconv.Itoa(i + 1)
+		built[i] = Choice{ID: id, Label: label}
+	}
+	if qt.choicesAreQuestions() {
+		q.subQuestions = built
+	} else {
+		for i := range built {
+			built[i].Recode = built[i].ID
+		}
+		q.choices = built
+	}
+
+	s.Questions[q.ID] = q
+	b.QuestionIDs = append(b.QuestionIDs, q.ID)
+	embeddedDataIDs := s.embeddedDataIDs()
+	s.sortQuestions()
+	s.addEmbeddedData(embeddedDataIDs)
+	return q, nil
+}
+
+// AddEmbeddedData adds an embedded data field after the survey's other questions and fields.
+// WriteQsf sets it in the first embedded data element at the top level of the survey flow,
+// adding one to the start of the flow if there isn't one.
+func (s *Survey) AddEmbeddedData(field string, dt DataType) (*Question, error) {
+	if _, ok := s.Questions[field]; ok {
+		return nil, fmt.Errorf("survey already has a question or field named '%s'", field)
+	}
+	q := &Question{ID: field, label: field, qType: Embedded, dataType: dt}
+	s.Questions[field] = q
+	s.QuestionOrder = append(s.QuestionOrder, field)
+	return q, nil
+}
+
+// BranchCondition is the condition of a branch added with AddBranch. Create one with ChoiceSelected or FieldEquals.
+type BranchCondition struct {
+	questionID string
+	choiceID   string
+	field      string
+	value      string
+}
+
+// ChoiceSelected returns a condition that holds when the respondent selected the given choice of a multiple choice question
+func ChoiceSelected(questionID, choiceID string) BranchCondition {
+	return BranchCondition{questionID: questionID, choiceID: choiceID}
+}
+
+// FieldEquals returns a condition that holds when the embedded data field is equal to value
+func FieldEquals(field, value string) BranchCondition {
+	return BranchCondition{field: field, value: value}
+}
+
+// AddRandomizer moves the given blocks into a new randomizer at the end of the survey flow and returns its FlowID.
+// The randomizer shows n of the blocks to each respondent, in random order, presenting each block to about the same
+// number of respondents; if n is 0, it shows every block.
+func (s *Survey) AddRandomizer(blockIDs []string, n int) (string, error) {
+	if n < 0 || n > len(blockIDs) {
+		return "", fmt.Errorf("cannot show %d of %d blocks", n, len(blockIDs))
+	}
+	if n == 0 {
+		n = len(blockIDs)
+	}
+	return s.addFlowContainer(qsfObject{"Type": "BlockRandomizer", "SubSet": n, "EvenPresentation": true}, blockIDs)
+}
+
+// AddBranch moves the given blocks into a new branch at the end of the survey flow and returns its FlowID.
+// Respondents only see the blocks if cond holds.
+func (s *Survey) AddBranch(cond BranchCondition, blockIDs ...string) (string, error) {
+	var expr qsfObject
+	if cond.questionID != "" {
+		q, ok := s.Questions[cond.questionID]
+		if !ok || (q.qType != MultipleChoiceSingleResponse && q.qType != MultipleChoiceMultiResponse) {
+			return "", fmt.Errorf("no multiple choice question with ID '%s'", cond.questionID)
+		}
+		var choice *Choice
+		for i := range q.choices {
+			if q.choices[i].ID == cond.choiceID {
+				choice = &q.choices[i]
+			}
+		}
+		if choice == nil {
+			return "", fmt.Errorf("question %s has no choice with ID '%s'", q.ID, cond.choiceID)
+		}
+		locator := fmt.Sprintf("q://%s/SelectableChoice/%s", q.ID, choice.ID)
+		expr = qsfObject{
+			"LogicType": "Question", "QuestionID": q.ID, "QuestionIsInLoop": "no", "ChoiceLocator": locator, "Operator": "Selected",
+			"QuestionIDFromLocator": q.ID, "LeftOperand": locator, "Type": "Expression",
+			"Description": fmt.Sprintf(`<span class="ConjDesc">If</span> <span class="QuestionDesc">%s</span> <span class="LeftOpDesc">%s</span> <span class="OpDesc">Is Selected</span>`,
+				html.EscapeString(q.Wording), html.EscapeString(choice.Label)),
+		}
+	} else {
+		if q, ok := s.Questions[cond.field]; !ok || q.qType != Embedded {
+			return "", fmt.Errorf("no embedded data field named '%s'", cond.field)
+		}
+		expr = qsfObject{
+			"LogicType": "EmbeddedField", "LeftOperand": cond.field, "Operator": "EqualTo", "RightOperand": cond.value, "Type": "Expression",
+			"Description": fmt.Sprintf(`<span class="ConjDesc">If</span> <span class="LeftOpDesc">%s</span> <span class="OpDesc">Is Equal to</span> <span class="RightOpDesc"> %s </span>`,
+				html.EscapeString(cond.field), html.EscapeString(cond.value)),
+		}
+	}
+	logic := qsfObject{"0": qsfObject{"0": expr, "Type": "If"}, "Type": "BooleanExpression"}
+	return s.addFlowContainer(qsfObject{"Type": "Branch", "Description": "New Branch", "BranchLogic": logic}, blockIDs)
+}
+
+// AddEmbeddedDataElement adds an element to the end of the survey flow that sets each of the given embedded data fields
+// to its value, and returns its FlowID. Add the fields with AddEmbeddedData first.
+func (s *Survey) AddEmbeddedDataElement(values map[string]string) (string, error) {
+	if len(values) == 0 {
+		return "", errors.New("no embedded data values to set")
+	}
+	flow, err := s.flow()
+	if err != nil {
+		return "", err
+	}
+	s.addBlocksToFlow(flow)
+	fields := []interface{}{}
+	for _, field := range sortedKeys(values) {
+		q, ok := s.Questions[field]
+		if !ok || q.qType != Embedded {
+			return "", fmt.Errorf("no embedded data field named '%s'", field)
+		}
+		fields = append(fields, qsfObject{"Description": field, "Type": "Custom", "Field": field, "VariableType": q.dataType.qsfVariableType(),
+			"DataVisibility": []interface{}{}, "AnalyzeText": false, "Value": values[field]})
+	}
+	entry := qsfObject{"Type": "EmbeddedData", "EmbeddedData": fields}
+	addToFlow(flow, entry, false)
+	return entry["FlowID"].(string), nil
+}
+
+// addFlowContainer moves the given blocks into container, a randomizer or branch, and adds it to the end of the survey flow
+func (s *Survey) addFlowContainer(container qsfObject, blockIDs []string) (string, error) {
+	if len(blockIDs) == 0 {
+		return "", errors.New("no blocks to add")
+	}
+	seen := make(map[string]bool)
+	for _, id := range blockIDs {
+		if b, ok := s.blocks[id]; !ok || b.Type == "Trash" || !contains(s.blockOrder, id) {
+			return "", fmt.Errorf("no block with ID '%s'", id)
+		}
+		if seen[id] {
+			return "", fmt.Errorf("block '%s' is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	flow, err := s.flow()
+	if err != nil {
+		return "", err
+	}
+
+	s.addBlocksToFlow(flow)
+	children := []interface{}{}
+	for _, id := range blockIDs {
+		children = append(children, removeFromFlow(flow, id))
+	}
+	container["Flow"] = children
+	addToFlow(flow, container, false)
+
+	// The blocks now come last in the flow
+	embeddedDataIDs := s.embeddedDataIDs()
+	order := []string{}
+	for _, id := range s.blockOrder {
+		if !seen[id] {
+			order = append(order, id)
+		}
+	}
+	s.blockOrder = append(order, blockIDs...)
+	s.sortQuestions()
+	s.addEmbeddedData(embeddedDataIDs)
+	return container["FlowID"].(string), nil
+}
+
+// nextQuestionNumber returns the lowest number n greater than all existing question numbers,
+// such that neither QIDn nor Qn is in use. Questions in the trash still hold their IDs and tags,
+// so the QSF document's question elements count as well as s.Questions.
+func (s *Survey) nextQuestionNumber() int {
+	n := 1
+	tags := make(map[string]bool)
+	use := func(id, tag string) {
+		if m := reQID.FindStringSubmatch(id); m != nil {
+			if i, err := strconv.Atoi(m[1]); err == nil && i >= n {
+				n = i + 1
+			}
+		}
+		tags[tag] = true
+	}
+	for id, q := range s.Questions {
+		use(id, q.dataExportTag)
+	}
+	elements, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	for _, e := range elements {
+		element, ok := e.(qsfObject)
+		if !ok || element["Element"] != "SQ" {
+			continue
+		}
+		if payload, ok := element["Payload"].(qsfObject); ok {
+			id, _ := payload["QuestionID"].(string)
+			tag, _ := payload["DataExportTag"].(string)
+			use(id, tag)
+		}
+	}
+	for tags[fmt.Sprintf("Q%d", n)] {
+		n++
+	}
+	return n
+}
+
+// qsfVariableType returns the Qualtrics VariableType used for embedded data of this DataType
+func (dt DataType) qsfVariableType() string {
+	switch dt {
+	case NumberData:
+		return "Number"
+	case DateData, DateTimeData:
+		return "Date"
+	case CategoricalData:
+		return "TextSet"
+	}
+	return "String"
+}
+
+// qsfElement returns a new SQ survey element describing q
+func (q *Question) qsfElement(surveyID string) (qsfObject, error) {
+	types, ok := qsfQuestionTypes[q.qType]
+	if !ok {
+		return nil, fmt.Errorf("cannot write %s question %s", q.qType, q.ID)
+	}
+	payload := qsfObject{
+		"QuestionText":        q.Wording,
+		"DefaultChoices":      false,
+		"DataExportTag":       q.dataExportTag,
+		"QuestionType":        types[0],
+		"Selector":            types[1],
+		"Configuration":       qsfObject{"QuestionDescriptionOption": "UseText"},
+		"QuestionDescription": q.Wording,
+		"Validation":          qsfObject{"Settings": qsfObject{"ForceResponse": "OFF", "ForceResponseType": "ON", "Type": "None"}},
+		"Language":            []interface{}{},
+		"NextChoiceId":        1,
+		"NextAnswerId":        1,
+		"QuestionID":          q.ID,
+		"DataVisibility":      qsfObject{"Private": false, "Hidden": false},
+	}
+	if types[2] != "" {
+		payload["SubSelector"] = types[2]
+	}
+	switch {
+	case q.qType == Timing:
+		payload["Choices"] = qsfObject{
+			"1": qsfObject{"Display": "First Click"},
+			"2": qsfObject{"Display": "Last Click"},
+			"3": qsfObject{"Display": "Page Submit"},
+			"4": qsfObject{"Display": "Click Count"},
+		}
+		payload["NextChoiceId"] = 5
+	case q.qType.choicesAreQuestions():
+		if err := patchChoices(payload, "Choices", "ChoiceOrder", "NextChoiceId", q.subQuestions); err != nil {
+			return nil, err
+		}
+		if err := patchChoices(payload, "Answers", "AnswerOrder", "NextAnswerId", q.choices); err != nil {
+			return nil, err
+		}
+	case q.qType != Description && q.qType != TextEntry:
+		if err := patchChoices(payload, "Choices", "ChoiceOrder", "NextChoiceId", q.choices); err != nil {
+			return nil, err
+		}
+	}
+	return qsfObject{
+		"SurveyID":           surveyID,
+		"Element":            "SQ",
+		"PrimaryAttribute":   q.ID,
+		"SecondaryAttribute": reSpaces.ReplaceAllString(strings.TrimSpace(q.Wording), " "),
+		"TertiaryAttribute":  nil,
+		"Payload":            payload,
+	}, nil
+}
+
+const qualtricsIDChars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newQualtricsID returns a random ID in the style Qualtrics uses, e.g., BL_86vwFSQoawhxvMx
+func newQualtricsID(prefix string) string {
+	id := make([]byte, 15)
+	for i := range id {
+		id[i] = qualtricsIDChars[rand.Intn(len(qualtricsIDChars))]
+	}
+	return prefix + string(id)
+}
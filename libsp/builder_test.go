@@ -0,0 +1,335 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuildSurvey(t *testing.T) {
+	s := NewSurvey("Built survey")
+	intro := s.AddBlock("Intro")
+	main := s.AddBlock("Main")
+	if _, err := s.AddQuestion(intro, Description, "Welcome!"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	mc, err := s.AddQuestion(main, MultipleChoiceSingleResponse, "Pick one", "Red", "Green", "Blue")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	matrix, err := s.AddQuestion(main, MatrixSingleResponse, "Rate these", "Apples", "Pears")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, label := range []string{"Bad", "OK", "Good"} {
+		if _, err = matrix.AddChoice(label); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+	}
+	if _, err = s.AddQuestion(main, TextEntry, "Anything else?"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddEmbeddedData("group", CategoricalData); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddQuestion(main, PickGroupRank, "Not supported"); err == nil {
+		t.Errorf("AddQuestion(PickGroupRank) should fail")
+	}
+	if _, err = s.AddQuestion("BL_missing", TextEntry, "No block"); err == nil {
+		t.Errorf("AddQuestion() with an unknown block should fail")
+	}
+	if mc.ID != "QID2" || mc.ExportTag() != "Q2" {
+		t.Errorf("mc = (%s, %s); want (QID2, Q2)", mc.ID, mc.ExportTag())
+	}
+
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// Writing again shouldn't add anything twice
+	var b2 bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b2)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if b.String() != b2.String() {
+		t.Errorf("second WriteQsf() differs from the first")
+	}
+	if !strings.Contains(b.String(), `"SecondaryAttribute":"4"`) {
+		t.Errorf("question count should be 4")
+	}
+
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if s2.Title != "Built survey" {
+		t.Errorf("Title = '%s'; want 'Built survey'", s2.Title)
+	}
+	if !equalStrings(s2.BlockOrder(), []string{intro, main}) {
+		t.Errorf("BlockOrder() = %v; want %v", s2.BlockOrder(), []string{intro, main})
+	}
+	if want := []string{"QID1", "QID2", "QID3", "QID4", "group"}; !equalStrings(s2.QuestionOrder, want) {
+		t.Errorf("QuestionOrder = %v; want %v", s2.QuestionOrder, want)
+		return
+	}
+	tests := []struct {
+		id       string
+		qType    QType
+		choices  []string
+		subQs    []string
+		csvCols  []string
+		dataType DataType
+	}{
+		{"QID1", Description, nil, nil, nil, UnknownData},
+		{"QID2", MultipleChoiceSingleResponse, []string{"Red", "Green", "Blue"}, nil, []string{"Q2"}, UnknownData},
+		{"QID3", MatrixSingleResponse, []string{"Bad", "OK", "Good"}, []string{"Apples", "Pears"}, []string{"Q3_1", "Q3_2"}, UnknownData},
+		{"QID4", TextEntry, nil, nil, []string{"Q4_text"}, UnknownData},
+		{"group", Embedded, nil, nil, []string{"group"}, CategoricalData},
+	}
+	for _, test := range tests {
+		q := s2.Questions[test.id]
+		if q.Type() != test.qType {
+			t.Errorf("%s type = %s; want %s", test.id, q.Type(), test.qType)
+		}
+		if got := choiceLabels(q.ResponseChoices()); !equalStrings(got, test.choices) {
+			t.Errorf("%s choices = %v; want %v", test.id, got, test.choices)
+		}
+		if got := choiceLabels(q.SubQuestions()); !equalStrings(got, test.subQs) {
+			t.Errorf("%s subquestions = %v; want %v", test.id, got, test.subQs)
+		}
+		if got := q.CSVCols(); !equalStrings(got, test.csvCols) {
+			t.Errorf("%s columns = %v; want %v", test.id, got, test.csvCols)
+		}
+		if q.DataType() != test.dataType {
+			t.Errorf("%s data type = %s; want %s", test.id, q.DataType(), test.dataType)
+		}
+	}
+}
+
+func TestAddQuestionToExistingSurvey(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	blockID := s.BlockOrder()[0]
+	q, err := s.AddQuestion(blockID, TextEntry, "A new question")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, ok := s.Questions[q.ID]; !ok || q.ID == "QID1" {
+		t.Errorf("q.ID = %s; want an unused ID", q.ID)
+	}
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	ids := s2.blocks[blockID].QuestionIDs
+	if len(ids) == 0 || ids[len(ids)-1] != q.ID {
+		t.Errorf("block questions = %v; want %s last", ids, q.ID)
+	}
+	if got := s2.Questions[q.ID]; got == nil || got.Wording != "A new question" {
+		t.Errorf("Questions[%s] = %+v", q.ID, got)
+	}
+}
+
+func TestAddQuestionAfterTrash(t *testing.T) {
+	s := NewSurvey("Trashed")
+	main := s.AddBlock("Main")
+	for _, wording := range []string{"First", "Second"} {
+		if _, err := s.AddQuestion(main, TextEntry, wording); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+	}
+	// Move QID2, the highest-numbered question, to the trash
+	for _, b := range s.blocks {
+		if b.Type == "Trash" {
+			b.QuestionIDs = append(b.QuestionIDs, "QID2")
+		}
+	}
+	s.blocks[main].QuestionIDs = []string{"QID1"}
+	var b bytes.Buffer
+	if err := s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, ok := s2.Questions["QID2"]; ok {
+		t.Errorf("QID2 should be in the trash")
+	}
+	q, err := s2.AddQuestion(main, TextEntry, "Third")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if q.ID != "QID3" || q.ExportTag() != "Q3" {
+		t.Errorf("q = (%s, %s); want (QID3, Q3)", q.ID, q.ExportTag())
+	}
+	b.Reset()
+	if err = s2.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if n := strings.Count(b.String(), `"PrimaryAttribute":"QID2"`); n != 1 {
+		t.Errorf("QSF has %d QID2 elements; want 1", n)
+	}
+}
+
+func TestBuildFlow(t *testing.T) {
+	s := NewSurvey("Flow")
+	intro := s.AddBlock("Intro")
+	blocks := []string{}
+	for _, d := range []string{"A", "B", "Green", "Group A"} {
+		id := s.AddBlock(d)
+		if _, err := s.AddQuestion(id, TextEntry, "In block "+d); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		blocks = append(blocks, id)
+	}
+	mc, err := s.AddQuestion(intro, MultipleChoiceSingleResponse, "Pick one", "Red", "Green")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddEmbeddedData("group", CategoricalData); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddEmbeddedDataElement(map[string]string{"group": "A"}); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddRandomizer(blocks[:2], 1); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddBranch(ChoiceSelected(mc.ID, "2"), blocks[2]); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddBranch(FieldEquals("group", "A"), blocks[3]); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	errTests := []struct {
+		name string
+		add  func() (string, error)
+	}{
+		{"randomizer of no blocks", func() (string, error) { return s.AddRandomizer(nil, 0) }},
+		{"randomizer showing too many blocks", func() (string, error) { return s.AddRandomizer(blocks[:1], 2) }},
+		{"randomizer with an unknown block", func() (string, error) { return s.AddRandomizer([]string{"BL_missing"}, 0) }},
+		{"randomizer with a repeated block", func() (string, error) { return s.AddRandomizer([]string{intro, intro}, 0) }},
+		{"branch on an unknown choice", func() (string, error) { return s.AddBranch(ChoiceSelected(mc.ID, "9"), intro) }},
+		{"branch on a text question", func() (string, error) { return s.AddBranch(ChoiceSelected("QID1", "1"), intro) }},
+		{"branch on an unknown field", func() (string, error) { return s.AddBranch(FieldEquals("missing", "A"), intro) }},
+		{"embedded data for an unknown field", func() (string, error) { return s.AddEmbeddedDataElement(map[string]string{"missing": "A"}) }},
+	}
+	for _, test := range errTests {
+		if _, err := test.add(); err == nil {
+			t.Errorf("%s: err = nil; want an error", test.name)
+		}
+	}
+
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, id := range append([]string{intro}, blocks...) {
+		// Once in the survey blocks, and once in the flow
+		if n := strings.Count(b.String(), `"ID":"`+id+`"`); n != 2 {
+			t.Errorf("QSF mentions block %s %d times; want 2", id, n)
+		}
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if want := append([]string{intro}, blocks...); !equalStrings(s2.BlockOrder(), want) {
+		t.Errorf("BlockOrder() = %v; want %v", s2.BlockOrder(), want)
+	}
+	if want := []string{"QID5", "QID1", "QID2", "QID3", "QID4", "group"}; !equalStrings(s2.QuestionOrder, want) {
+		t.Errorf("QuestionOrder = %v; want %v", s2.QuestionOrder, want)
+	}
+	elements, order := s2.flowElements()
+	summaries := []string{}
+	for _, id := range order {
+		summaries = append(summaries, elements[id].summary)
+	}
+	want := []string{
+		"embedded data: group",
+		"embedded data: group=A",
+		"randomizer showing 1 of [" + blocks[0] + ", " + blocks[1] + "]",
+		"branch If Pick one Green Is Selected: [" + blocks[2] + "]",
+		"branch If group Is Equal to A: [" + blocks[3] + "]",
+	}
+	if !equalStrings(summaries, want) {
+		t.Errorf("flow = %q; want %q", summaries, want)
+	}
+}
+
+func TestAddRandomizerToExistingSurvey(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	order := s.BlockOrder()
+	if _, err = s.AddRandomizer(order[1:3], 0); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	want := append(append([]string{order[0]}, order[3:]...), order[1:3]...)
+	if !equalStrings(s.BlockOrder(), want) {
+		t.Errorf("BlockOrder() = %v; want %v", s.BlockOrder(), want)
+	}
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if !equalStrings(s2.BlockOrder(), want) {
+		t.Errorf("BlockOrder() after WriteQsf = %v; want %v", s2.BlockOrder(), want)
+	}
+	if !equalStrings(s2.QuestionOrder, s.QuestionOrder) {
+		t.Errorf("QuestionOrder after WriteQsf = %v; want %v", s2.QuestionOrder, s.QuestionOrder)
+	}
+}
+
+func choiceLabels(choices []Choice) []string {
+	var labels []string
+	for _, c := range choices {
+		labels = append(labels, c.Label)
+	}
+	return labels
+}
@@ -0,0 +1,112 @@
+package libsp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// codebookEntry describes a single column of WriteCSV's output
+type codebookEntry struct {
+	column       string
+	questionID   string
+	questionType string
+	wording      string
+	subquestion  string
+	choice       string
+	colType      string // R column type without the col_ prefix, e.g. "factor"
+	ordered      bool
+	levels       []string // factor levels; in numeric mode, "code = label"
+}
+
+// codebookHeader holds the column headers for codebookEntry.row()
+var codebookHeader = []string{"column", "question_id", "question_type", "wording", "subquestion", "choice", "type", "ordered", "levels"}
+
+// codebook returns an entry for each column in csvCols()
+func (s *Survey) codebook() []codebookEntry {
+	cols := s.csvCols()
+	colTypes := s.csvColTypes()
+	entries := make([]codebookEntry, 0, len(cols))
+	i := 0
+	addEntry := func(e codebookEntry) {
+		e.column = cols[i]
+		e.colType = strings.TrimSuffix(strings.TrimPrefix(colTypes[i], "col_"), "()")
+		entries = append(entries, e)
+		i++
+	}
+
+	for range responseCols {
+		addEntry(codebookEntry{questionType: "Response"})
+	}
+	for range s.metadataCols() {
+		addEntry(codebookEntry{questionType: "Response"})
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		details := q.longCols()
+		for j, colID := range q.CSVCols() {
+			e := codebookEntry{
+				questionID:   q.ID,
+				questionType: q.qType.String(),
+				wording:      q.Translation(q.language),
+				subquestion:  details[j].subquestion,
+				choice:       details[j].choice,
+			}
+			if rColType, isRankCol := getColType(colID, q); rColType == "col_factor()" {
+				choices, ordered := factorLevels(q, isRankCol)
+				e.ordered = ordered
+				numeric := s.NumericCodes && q.hasCodes(isRankCol)
+				for _, c := range choices {
+					if numeric {
+						e.levels = append(e.levels, c.code()+" = "+c.Label)
+					} else {
+						e.levels = append(e.levels, c.Label)
+					}
+				}
+			}
+			addEntry(e)
+		}
+	}
+	for _, c := range s.Scoring {
+		addEntry(codebookEntry{questionType: "Score", wording: c.Name})
+	}
+	return entries
+}
+
+// WriteCodebook saves a CSV file describing each column of WriteCSV's output: its question, type, and factor levels.
+// Wording and labels are in the language selected with SetLanguage.
+func (s *Survey) WriteCodebook(bw *bufio.Writer) error {
+	if bw == nil {
+		return errors.New("bw cannot be nil")
+	}
+
+	w := csv.NewWriter(bw)
+	if err := w.Write(codebookHeader); err != nil {
+		return fmt.Errorf("could not write codebook columns: %s", err)
+	}
+	for _, e := range s.codebook() {
+		if err := w.Write(e.row()); err != nil {
+			return fmt.Errorf("could not write codebook row: %s", err)
+		}
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing codebook: %s", err)
+	}
+	return nil
+}
+
+// row returns the fields of e in the order of codebookHeader
+func (e codebookEntry) row() []string {
+	ordered := ""
+	if len(e.levels) > 0 {
+		ordered = "false"
+		if e.ordered {
+			ordered = "true"
+		}
+	}
+	return []string{e.column, e.questionID, e.questionType, e.wording, e.subquestion, e.choice, e.colType, ordered, strings.Join(e.levels, "; ")}
+}
@@ -0,0 +1,116 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestCodebook(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	entries := s.codebook()
+	if len(entries) != len(s.csvCols()) {
+		t.Errorf("len(entries) = %d; want %d", len(entries), len(s.csvCols()))
+		return
+	}
+
+	tests := []struct {
+		column  string
+		want    []string
+		numeric bool
+	}{
+		{"finished", []string{"finished", "", "Response", "", "", "", "logical", "", ""}, false},
+		{"Q1Label", []string{"Q1Label", "QID1", "MultipleChoiceSingleResponse", s.Questions["QID1"].Wording, "", "", "factor", "false",
+			"Click to write Choice 1; Click to write Choice 2; Click to write Choice 3; No response"}, false},
+		{"Q1Label", []string{"Q1Label", "QID1", "MultipleChoiceSingleResponse", s.Questions["QID1"].Wording, "", "", "double", "false",
+			"1 = Click to write Choice 1; 2 = Click to write Choice 2; 3 = Click to write Choice 3; -99 = No response"}, true},
+		{"Q16_first_click", []string{"Q16_first_click", "QID16", "Timing", s.Questions["QID16"].Wording, "First Click", "", "double", "", ""}, false},
+	}
+	for _, test := range tests {
+		s.NumericCodes = test.numeric
+		for _, e := range s.codebook() {
+			if e.column != test.column {
+				continue
+			}
+			got := e.row()
+			for i := range test.want {
+				if got[i] != test.want[i] {
+					t.Errorf("%s %s = '%s'; want '%s'", test.column, codebookHeader[i], got[i], test.want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestWriteCodebook(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b strings.Builder
+	if err = s.WriteCodebook(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(s.csvCols())+1 {
+		t.Errorf("len(lines) = %d; want %d", len(lines), len(s.csvCols())+1)
+		return
+	}
+	if want := strings.Join(codebookHeader, ","); lines[0] != want {
+		t.Errorf("lines[0] = '%s'; want '%s'", lines[0], want)
+	}
+	if want := "Q16_click_count,QID16,Timing,Timing,Click Count,,integer,,"; !contains(lines, want) {
+		t.Errorf("codebook does not contain '%s'", want)
+	}
+	if err = s.WriteCodebook(nil); err == nil {
+		t.Errorf("WriteCodebook(nil) err = nil; want error")
+	}
+}
+
+func TestCodebookLanguage(t *testing.T) {
+	s := readTranslatedSurvey(t)
+	if s == nil {
+		return
+	}
+	if err := s.SetLanguage("DE"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	tests := []struct {
+		questionID  string
+		wording     string
+		subquestion string
+		levels      string
+	}{
+		{"QID1", "Ist der Himmel blau?", "", "Ja; Nein; No response"},
+		{"QID2", "Wie sehr mögen Sie...", "Äpfel", "Sehr; Gar nicht; No response"},
+	}
+	for _, test := range tests {
+		found := false
+		for _, e := range s.codebook() {
+			if e.questionID != test.questionID || found {
+				continue
+			}
+			found = true
+			if e.wording != test.wording {
+				t.Errorf("%s wording = '%s'; want '%s'", test.questionID, e.wording, test.wording)
+			}
+			if e.subquestion != test.subquestion {
+				t.Errorf("%s subquestion = '%s'; want '%s'", test.questionID, e.subquestion, test.subquestion)
+			}
+			if levels := strings.Join(e.levels, "; "); levels != test.levels {
+				t.Errorf("%s levels = '%s'; want '%s'", test.questionID, levels, test.levels)
+			}
+		}
+		if !found {
+			t.Errorf("no codebook entry for %s", test.questionID)
+		}
+	}
+}
@@ -2468,4 +2468,320 @@ text?</QID8_TEXT>
 	</Response>
 </Responses>`
 
+var qsfScoringContent = `{
+    "SurveyEntry": {
+        "SurveyID": "SV_scoring",
+        "SurveyName": "Scoring survey",
+        "SurveyStatus": "Active"
+    },
+    "SurveyElements": [{
+        "Element": "BL",
+        "PrimaryAttribute": "Survey Blocks",
+        "Payload": [{
+            "Type": "Default",
+            "Description": "Default Question Block",
+            "ID": "BL_1",
+            "BlockElements": [{
+                "Type": "Question",
+                "QuestionID": "QID1"
+            }, {
+                "Type": "Question",
+                "QuestionID": "QID2"
+            }]
+        }]
+    }, {
+        "Element": "FL",
+        "PrimaryAttribute": "Survey Flow",
+        "Payload": {
+            "Type": "Root",
+            "FlowID": "FL_1",
+            "Flow": [{
+                "Type": "Block",
+                "ID": "BL_1",
+                "FlowID": "FL_2"
+            }]
+        }
+    }, {
+        "Element": "SCO",
+        "PrimaryAttribute": "Scoring",
+        "Payload": {
+            "ScoringCategories": [{
+                "ID": "SC_knowledge",
+                "Name": "Knowledge",
+                "Description": ""
+            }],
+            "ScoringCategoryGroups": [],
+            "ScoringSummaryCategory": null,
+            "DefaultScoringCategory": "SC_knowledge"
+        }
+    }, {
+        "Element": "SQ",
+        "PrimaryAttribute": "QID1",
+        "Payload": {
+            "QuestionText": "Is the sky blue?",
+            "DataExportTag": "Q1",
+            "QuestionType": "MC",
+            "Selector": "SAVR",
+            "SubSelector": "TX",
+            "QuestionDescription": "Is the sky blue?",
+            "Choices": {
+                "1": {"Display": "Yes"},
+                "2": {"Display": "No"}
+            },
+            "ChoiceOrder": ["1", "2"],
+            "GradingData": [{
+                "ChoiceID": "1",
+                "Grades": {"SC_knowledge": "1"},
+                "Index": 0
+            }, {
+                "ChoiceID": 2,
+                "Grades": {"SC_knowledge": 0},
+                "Index": 1
+            }],
+            "QuestionID": "QID1"
+        }
+    }, {
+        "Element": "SQ",
+        "PrimaryAttribute": "QID2",
+        "Payload": {
+            "QuestionText": "Which are primes?",
+            "DataExportTag": "Q2",
+            "QuestionType": "MC",
+            "Selector": "MAVR",
+            "SubSelector": "TX",
+            "QuestionDescription": "Which are primes?",
+            "Choices": {
+                "1": {"Display": "2"},
+                "2": {"Display": "4"},
+                "3": {"Display": "5"}
+            },
+            "ChoiceOrder": ["1", "2", "3"],
+            "GradingData": [{
+                "ChoiceID": "1",
+                "Grades": {"SC_knowledge": "2"}
+            }, {
+                "ChoiceID": "2",
+                "Grades": {"SC_knowledge": "-1"}
+            }, {
+                "ChoiceID": "3",
+                "Grades": {"SC_knowledge": "2.5"}
+            }],
+            "QuestionID": "QID2"
+        }
+    }]
+}`
+
+var xmlScoringContent = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<progress>100</progress>
+		<duration>10</duration>
+		<finished>True</finished>
+		<recordedDate>2020-11-09 13:12:11</recordedDate>
+		<_recordId>R_1</_recordId>
+		<QID1>Yes</QID1>
+		<QID2_1>2</QID2_1>
+		<QID2_2>-99</QID2_2>
+		<QID2_3>5</QID2_3>
+		<SC_knowledge>5.5</SC_knowledge>
+	</Response>
+	<Response>
+		<progress>100</progress>
+		<duration>12</duration>
+		<finished>True</finished>
+		<recordedDate>2020-11-09 13:14:11</recordedDate>
+		<_recordId>R_2</_recordId>
+		<QID1>No</QID1>
+		<QID2_1>-99</QID2_1>
+		<QID2_2>4</QID2_2>
+		<QID2_3>-99</QID2_3>
+		<SC_knowledge>0</SC_knowledge>
+	</Response>
+</Responses>`
+
+var qsfTranslatedContent = `{
+    "SurveyEntry": {
+        "SurveyID": "SV_translated",
+        "SurveyName": "Translated survey",
+        "SurveyLanguage": "EN",
+        "SurveyStatus": "Active"
+    },
+    "SurveyElements": [{
+        "Element": "BL",
+        "PrimaryAttribute": "Survey Blocks",
+        "Payload": [{
+            "Type": "Default",
+            "Description": "Default Question Block",
+            "ID": "BL_1",
+            "BlockElements": [{
+                "Type": "Question",
+                "QuestionID": "QID1"
+            }, {
+                "Type": "Question",
+                "QuestionID": "QID2"
+            }]
+        }]
+    }, {
+        "Element": "FL",
+        "PrimaryAttribute": "Survey Flow",
+        "Payload": {
+            "Type": "Root",
+            "FlowID": "FL_1",
+            "Flow": [{
+                "Type": "Block",
+                "ID": "BL_1",
+                "FlowID": "FL_2"
+            }]
+        }
+    }, {
+        "Element": "SQ",
+        "PrimaryAttribute": "QID1",
+        "Payload": {
+            "QuestionText": "Is the sky blue?",
+            "DataExportTag": "Q1",
+            "QuestionType": "MC",
+            "Selector": "SAVR",
+            "SubSelector": "TX",
+            "QuestionDescription": "sky",
+            "Choices": {
+                "1": {"Display": "Yes"},
+                "2": {"Display": "No"}
+            },
+            "ChoiceOrder": ["1", "2"],
+            "Language": {
+                "DE": {
+                    "QuestionText": "Ist der Himmel blau?",
+                    "Choices": {
+                        "1": {"Display": "Ja"},
+                        "2": {"Display": "Nein"}
+                    }
+                }
+            },
+            "QuestionID": "QID1"
+        }
+    }, {
+        "Element": "SQ",
+        "PrimaryAttribute": "QID2",
+        "Payload": {
+            "QuestionText": "How much do you like...",
+            "DataExportTag": "Q2",
+            "QuestionType": "Matrix",
+            "Selector": "Likert",
+            "SubSelector": "SingleAnswer",
+            "QuestionDescription": "like",
+            "Choices": {
+                "1": {"Display": "Apples"},
+                "2": {"Display": "Pears"}
+            },
+            "ChoiceOrder": ["1", "2"],
+            "Answers": {
+                "1": {"Display": "A lot"},
+                "2": {"Display": "Not at all"}
+            },
+            "AnswerOrder": ["1", "2"],
+            "ChoiceDataExportTags": false,
+            "Language": {
+                "DE": {
+                    "QuestionText": "Wie sehr mögen Sie...",
+                    "Choices": {
+                        "1": {"Display": "Äpfel"},
+                        "2": {"Display": "Birnen"}
+                    },
+                    "Answers": {
+                        "1": {"Display": "Sehr"},
+                        "2": {"Display": "Gar nicht"}
+                    }
+                }
+            },
+            "QuestionID": "QID2"
+        }
+    }]
+}`
+
+var xmlTranslatedContent = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<progress>100</progress>
+		<duration>10</duration>
+		<finished>True</finished>
+		<recordedDate>2020-11-09 13:12:11</recordedDate>
+		<_recordId>R_1</_recordId>
+		<userLanguage>EN</userLanguage>
+		<QID1>Yes</QID1>
+		<QID2_1>A lot</QID2_1>
+		<QID2_2>Not at all</QID2_2>
+	</Response>
+	<Response>
+		<progress>100</progress>
+		<duration>12</duration>
+		<finished>True</finished>
+		<recordedDate>2020-11-09 13:14:11</recordedDate>
+		<_recordId>R_2</_recordId>
+		<userLanguage>DE</userLanguage>
+		<QID1>Nein</QID1>
+		<QID2_1>Sehr</QID2_1>
+		<QID2_2>Sehr</QID2_2>
+	</Response>
+</Responses>`
+
+var xmlNumericContent = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<progress>100</progress>
+		<duration>122</duration>
+		<finished>1</finished>
+		<recordedDate>2019-08-20 12:44:31</recordedDate>
+		<_recordId>R_1</_recordId>
+		<QID1>2</QID1>
+		<QID18>2</QID18>
+		<QID5_1>3</QID5_1>
+		<QID5_2>-99</QID5_2>
+		<QID5_3>4</QID5_3>
+		<QID5_4>1</QID5_4>
+	</Response>
+</Responses>`
+
+var xmlMixedContent = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<progress>100</progress>
+		<duration>122</duration>
+		<finished>1</finished>
+		<recordedDate>2019-08-20 12:44:31</recordedDate>
+		<_recordId>R_1</_recordId>
+		<QID1>Click to write Choice 1</QID1>
+		<QID5_1>3</QID5_1>
+	</Response>
+</Responses>`
+
 // spell-checker: enable
+
+var xmlPreviewContent = `<?xml version="1.0" ?>
+<Responses>
+	<Response>
+		<status>IP Address</status>
+		<progress>100</progress>
+		<finished>True</finished>
+		<recordedDate>2019-08-20 12:44:31</recordedDate>
+		<_recordId>R_1</_recordId>
+		<distributionChannel>anonymous</distributionChannel>
+		<QID1>Click to write Choice 1</QID1>
+	</Response>
+	<Response>
+		<status>Survey Preview</status>
+		<progress>100</progress>
+		<finished>True</finished>
+		<recordedDate>2019-08-20 12:50:02</recordedDate>
+		<_recordId>R_2</_recordId>
+		<distributionChannel>preview</distributionChannel>
+		<QID1>Click to write Choice 2</QID1>
+	</Response>
+	<Response>
+		<progress>100</progress>
+		<finished>True</finished>
+		<recordedDate>2019-08-20 12:51:40</recordedDate>
+		<_recordId>R_3</_recordId>
+		<distributionChannel>test</distributionChannel>
+		<QID1>Click to write Choice 1</QID1>
+	</Response>
+</Responses>`
@@ -0,0 +1,457 @@
+package libsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChangeKind identifies the type of a Change between two versions of a survey
+type ChangeKind string
+
+// Kinds of changes reported by DiffSurveys
+const (
+	QuestionAdded      ChangeKind = "question_added"
+	QuestionRemoved    ChangeKind = "question_removed"
+	QuestionMoved      ChangeKind = "question_moved"
+	WordingChanged     ChangeKind = "wording_changed"
+	TypeChanged        ChangeKind = "type_changed"
+	ExportTagChanged   ChangeKind = "export_tag_changed"
+	ChoiceAdded        ChangeKind = "choice_added"
+	ChoiceRemoved      ChangeKind = "choice_removed"
+	ChoiceLabelChanged ChangeKind = "choice_label_changed"
+	ChoicesReordered   ChangeKind = "choices_reordered"
+	RecodeChanged      ChangeKind = "recode_changed"
+	BlockAdded         ChangeKind = "block_added"
+	BlockRemoved       ChangeKind = "block_removed"
+	BlocksReordered    ChangeKind = "blocks_reordered"
+	FlowElementAdded   ChangeKind = "flow_element_added"
+	FlowElementRemoved ChangeKind = "flow_element_removed"
+	FlowElementChanged ChangeKind = "flow_element_changed"
+)
+
+// Change describes a single difference between two versions of a survey
+type Change struct {
+	Kind        ChangeKind `json:"kind"`
+	QuestionID  string     `json:"question_id,omitempty"`
+	BlockID     string     `json:"block_id,omitempty"`
+	ChoiceID    string     `json:"choice_id,omitempty"`
+	FlowID      string     `json:"flow_id,omitempty"`
+	Subquestion bool       `json:"subquestion,omitempty"` // the choice is a subquestion, e.g., a matrix row
+	Old         string     `json:"old,omitempty"`
+	New         string     `json:"new,omitempty"`
+}
+
+// String returns a human-readable description of c
+func (c Change) String() string {
+	choice := "choice"
+	if c.Subquestion {
+		choice = "subquestion"
+	}
+	switch c.Kind {
+	case QuestionAdded:
+		return fmt.Sprintf("%s: question added: %s", c.QuestionID, c.New)
+	case QuestionRemoved:
+		return fmt.Sprintf("%s: question removed: %s", c.QuestionID, c.Old)
+	case QuestionMoved:
+		return fmt.Sprintf("%s: question moved from %s to %s", c.QuestionID, c.Old, c.New)
+	case WordingChanged:
+		return fmt.Sprintf("%s: wording changed from %q to %q", c.QuestionID, c.Old, c.New)
+	case TypeChanged:
+		return fmt.Sprintf("%s: type changed from %s to %s", c.QuestionID, c.Old, c.New)
+	case ExportTagChanged:
+		return fmt.Sprintf("%s: export tag changed from %s to %s", c.QuestionID, c.Old, c.New)
+	case ChoiceAdded:
+		return fmt.Sprintf("%s: %s %s added: %q", c.QuestionID, choice, c.ChoiceID, c.New)
+	case ChoiceRemoved:
+		return fmt.Sprintf("%s: %s %s removed: %q", c.QuestionID, choice, c.ChoiceID, c.Old)
+	case ChoiceLabelChanged:
+		return fmt.Sprintf("%s: %s %s changed from %q to %q", c.QuestionID, choice, c.ChoiceID, c.Old, c.New)
+	case ChoicesReordered:
+		return fmt.Sprintf("%s: %ss reordered from [%s] to [%s]", c.QuestionID, choice, c.Old, c.New)
+	case RecodeChanged:
+		return fmt.Sprintf("%s: recode value of choice %s changed from %s to %s", c.QuestionID, c.ChoiceID, c.Old, c.New)
+	case BlockAdded:
+		return fmt.Sprintf("%s: block added: %q", c.BlockID, c.New)
+	case BlockRemoved:
+		return fmt.Sprintf("%s: block removed: %q", c.BlockID, c.Old)
+	case BlocksReordered:
+		return fmt.Sprintf("survey flow: blocks reordered from [%s] to [%s]", c.Old, c.New)
+	case FlowElementAdded:
+		return fmt.Sprintf("%s: flow element added: %s", c.FlowID, c.New)
+	case FlowElementRemoved:
+		return fmt.Sprintf("%s: flow element removed: %s", c.FlowID, c.Old)
+	case FlowElementChanged:
+		return fmt.Sprintf("%s: flow element changed from %q to %q", c.FlowID, c.Old, c.New)
+	}
+	return string(c.Kind)
+}
+
+// DiffSurveys returns the structural changes between two versions of a survey: added, removed, and moved questions,
+// changes to question wording, type, export tag, choices, and recode values, changes to the blocks in the survey flow,
+// and added, removed, and changed flow elements such as embedded data, branches, and randomizers.
+// Questions, choices, and blocks are matched by ID, and flow elements by FlowID. Flow elements without a FlowID
+// are matched by their parent, type, and position, e.g., "FL_3/EndSurvey 2" for the second end of survey element in FL_3.
+// Flow elements are compared as they were read from the QSF files; a flow element that moves within the same
+// branch, randomizer, or group without other changes isn't reported.
+func DiffSurveys(old, new *Survey) []Change {
+	changes := diffBlocks(old, new)
+	changes = append(changes, diffFlow(old, new)...)
+
+	oldPositions := old.questionPositions()
+	newPositions := new.questionPositions()
+	for _, id := range old.QuestionOrder {
+		if _, ok := new.Questions[id]; !ok {
+			changes = append(changes, Change{Kind: QuestionRemoved, QuestionID: id, Old: old.Questions[id].summary()})
+		}
+	}
+	// Questions move if they change blocks, or change order relative to the other questions in their block
+	moved := make(map[string]bool)
+	for _, bid := range new.blockOrder {
+		ob, ok := old.blocks[bid]
+		if !ok {
+			continue
+		}
+		stayed := func(ids []string) []string {
+			common := []string{}
+			for _, id := range ids {
+				if oldPositions[id].blockID == bid && newPositions[id].blockID == bid {
+					common = append(common, id)
+				}
+			}
+			return common
+		}
+		for _, id := range notInLCS(stayed(ob.QuestionIDs), stayed(new.blocks[bid].QuestionIDs)) {
+			moved[id] = true
+		}
+	}
+	for _, id := range new.QuestionOrder {
+		q := new.Questions[id]
+		oq, ok := old.Questions[id]
+		if !ok {
+			changes = append(changes, Change{Kind: QuestionAdded, QuestionID: id, New: q.summary()})
+			continue
+		}
+		if moved[id] || oldPositions[id].blockID != newPositions[id].blockID {
+			changes = append(changes, Change{Kind: QuestionMoved, QuestionID: id, Old: oldPositions[id].String(), New: newPositions[id].String()})
+		}
+		changes = append(changes, diffQuestion(oq, q)...)
+	}
+	return changes
+}
+
+func diffBlocks(old, new *Survey) []Change {
+	changes := []Change{}
+	for _, id := range old.blockOrder {
+		if _, ok := new.blocks[id]; !ok || !contains(new.blockOrder, id) {
+			changes = append(changes, Change{Kind: BlockRemoved, BlockID: id, Old: old.blocks[id].Description})
+		}
+	}
+	for _, id := range new.blockOrder {
+		if !contains(old.blockOrder, id) {
+			changes = append(changes, Change{Kind: BlockAdded, BlockID: id, New: new.blocks[id].Description})
+		}
+	}
+	oldCommon := []string{}
+	for _, id := range old.blockOrder {
+		if contains(new.blockOrder, id) {
+			oldCommon = append(oldCommon, id)
+		}
+	}
+	newCommon := []string{}
+	for _, id := range new.blockOrder {
+		if contains(old.blockOrder, id) {
+			newCommon = append(newCommon, id)
+		}
+	}
+	if !equalStrings(oldCommon, newCommon) {
+		changes = append(changes, Change{Kind: BlocksReordered, Old: strings.Join(oldCommon, ", "), New: strings.Join(newCommon, ", ")})
+	}
+	return changes
+}
+
+func diffFlow(old, new *Survey) []Change {
+	changes := []Change{}
+	oldElements, oldOrder := old.flowElements()
+	newElements, newOrder := new.flowElements()
+	for _, id := range oldOrder {
+		if _, ok := newElements[id]; !ok {
+			changes = append(changes, Change{Kind: FlowElementRemoved, FlowID: id, Old: oldElements[id].summary})
+		}
+	}
+	for _, id := range newOrder {
+		e := newElements[id]
+		oe, ok := oldElements[id]
+		if !ok {
+			changes = append(changes, Change{Kind: FlowElementAdded, FlowID: id, New: e.summary})
+		} else if oe.summary != e.summary || oe.settings != e.settings {
+			changes = append(changes, Change{Kind: FlowElementChanged, FlowID: id, Old: oe.summary, New: e.summary})
+		}
+	}
+	return changes
+}
+
+// flowElement is an element of the survey flow other than a block, such as embedded data, a branch, or a randomizer
+type flowElement struct {
+	summary  string // a human-readable description, including the element's parent and children
+	settings string // the element's other settings as JSON, to catch changes its summary doesn't show
+}
+
+// flowElements returns the elements of s's survey flow other than blocks, keyed by FlowID, and their keys in flow order.
+// Elements without a FlowID are keyed by their parent, type, and position among their parent's elements of that type.
+func (s *Survey) flowElements() (map[string]flowElement, []string) {
+	elements := make(map[string]flowElement)
+	order := []string{}
+	var walk func(node qsfObject, id, parent string)
+	walk = func(node qsfObject, id, parent string) {
+		children, _ := node["Flow"].([]interface{})
+		childIDs := make([]string, len(children))
+		counts := make(map[string]int) // children without a FlowID, by type
+		for i, c := range children {
+			child, ok := c.(qsfObject)
+			if !ok {
+				continue
+			}
+			if blockID, ok := child["ID"].(string); ok && blockID != "" {
+				childIDs[i] = blockID
+			} else if flowID, ok := child["FlowID"].(string); ok && flowID != "" {
+				childIDs[i] = flowID
+			} else {
+				t, _ := child["Type"].(string)
+				counts[t]++
+				childIDs[i] = fmt.Sprintf("%s %d", t, counts[t])
+				if id != "" {
+					childIDs[i] = id + "/" + childIDs[i]
+				}
+			}
+		}
+		if node["Type"] != "Root" {
+			summary := flowSummary(node, nonEmpty(childIDs))
+			if parent != "" {
+				summary += fmt.Sprintf(" (in %s)", parent)
+			}
+			settings := qsfObject{}
+			for k, v := range node {
+				if k != "Flow" && k != "FlowID" {
+					settings[k] = v
+				}
+			}
+			b, _ := json.Marshal(settings)
+			elements[id] = flowElement{summary: summary, settings: string(b)}
+			order = append(order, id)
+			parent = id
+		}
+		for i, c := range children {
+			if child, ok := c.(qsfObject); ok {
+				if blockID, _ := child["ID"].(string); blockID == "" {
+					walk(child, childIDs[i], parent)
+				}
+			}
+		}
+	}
+	fl, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	for _, e := range fl {
+		if element, ok := e.(qsfObject); ok && element["Element"] == "FL" {
+			if payload, ok := element["Payload"].(qsfObject); ok {
+				walk(payload, "", "")
+			}
+		}
+	}
+	return elements, order
+}
+
+// nonEmpty returns the strings in ss that aren't empty
+func nonEmpty(ss []string) []string {
+	kept := []string{}
+	for _, s := range ss {
+		if s != "" {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// flowSummary returns a human-readable description of the flow element node, whose children have the IDs in children
+func flowSummary(node qsfObject, children []string) string {
+	list := "[" + strings.Join(children, ", ") + "]"
+	switch node["Type"] {
+	case "EmbeddedData":
+		fields := []string{}
+		data, _ := node["EmbeddedData"].([]interface{})
+		for _, d := range data {
+			field, ok := d.(qsfObject)
+			if !ok {
+				continue
+			}
+			f := fmt.Sprintf("%v", field["Field"])
+			if v, ok := field["Value"]; ok && v != nil && v != "" {
+				f += fmt.Sprintf("=%v", v)
+			}
+			fields = append(fields, f)
+		}
+		return "embedded data: " + strings.Join(fields, ", ")
+	case "BlockRandomizer", "Randomizer":
+		if n, ok := node["SubSet"]; ok && n != nil {
+			return fmt.Sprintf("randomizer showing %v of %s", n, list)
+		}
+		return "randomizer of " + list
+	case "Branch":
+		return fmt.Sprintf("branch %s: %s", strings.Join(logicDescriptions(node["BranchLogic"]), " "), list)
+	case "EndSurvey":
+		return "end of survey"
+	case "Group":
+		return fmt.Sprintf("group %q: %s", fmt.Sprintf("%v", node["Description"]), list)
+	}
+	if len(children) > 0 {
+		return fmt.Sprintf("%v: %s", node["Type"], list)
+	}
+	return fmt.Sprintf("%v", node["Type"])
+}
+
+// logicDescriptions returns the descriptions of the conditions in a branch's logic, without HTML tags, in order
+func logicDescriptions(logic interface{}) []string {
+	descriptions := []string{}
+	l, ok := logic.(qsfObject)
+	if !ok {
+		return descriptions
+	}
+	if d, ok := l["Description"].(string); ok {
+		descriptions = append(descriptions, strings.Join(strings.Fields(reHTMLTags.ReplaceAllString(d, " ")), " "))
+	}
+	for _, k := range sortedKeys(l) {
+		descriptions = append(descriptions, logicDescriptions(l[k])...)
+	}
+	return descriptions
+}
+
+func diffQuestion(old, new *Question) []Change {
+	changes := []Change{}
+	if old.qType != new.qType {
+		changes = append(changes, Change{Kind: TypeChanged, QuestionID: new.ID, Old: old.qType.String(), New: new.qType.String()})
+	}
+	if old.Wording != new.Wording {
+		changes = append(changes, Change{Kind: WordingChanged, QuestionID: new.ID, Old: old.Wording, New: new.Wording})
+	}
+	if old.dataExportTag != new.dataExportTag {
+		changes = append(changes, Change{Kind: ExportTagChanged, QuestionID: new.ID, Old: old.dataExportTag, New: new.dataExportTag})
+	}
+	changes = append(changes, diffChoices(new.ID, old.subQuestions, new.subQuestions, true)...)
+	changes = append(changes, diffChoices(new.ID, old.choices, new.choices, false)...)
+	return changes
+}
+
+func diffChoices(qid string, old, new []Choice, subquestions bool) []Change {
+	changes := []Change{}
+	oldByID := make(map[string]Choice)
+	for _, c := range old {
+		oldByID[c.ID] = c
+	}
+	newByID := make(map[string]Choice)
+	for _, c := range new {
+		newByID[c.ID] = c
+	}
+
+	oldCommon, newCommon := []string{}, []string{}
+	for _, c := range old {
+		if _, ok := newByID[c.ID]; !ok {
+			changes = append(changes, Change{Kind: ChoiceRemoved, QuestionID: qid, ChoiceID: c.ID, Subquestion: subquestions, Old: c.Label})
+		} else {
+			oldCommon = append(oldCommon, c.ID)
+		}
+	}
+	for _, c := range new {
+		oc, ok := oldByID[c.ID]
+		if !ok {
+			changes = append(changes, Change{Kind: ChoiceAdded, QuestionID: qid, ChoiceID: c.ID, Subquestion: subquestions, New: c.Label})
+			continue
+		}
+		newCommon = append(newCommon, c.ID)
+		if oc.Label != c.Label {
+			changes = append(changes, Change{Kind: ChoiceLabelChanged, QuestionID: qid, ChoiceID: c.ID, Subquestion: subquestions, Old: oc.Label, New: c.Label})
+		}
+		if oc.Recode != c.Recode {
+			changes = append(changes, Change{Kind: RecodeChanged, QuestionID: qid, ChoiceID: c.ID, Subquestion: subquestions, Old: oc.Recode, New: c.Recode})
+		}
+	}
+	if !equalStrings(oldCommon, newCommon) {
+		changes = append(changes, Change{Kind: ChoicesReordered, QuestionID: qid, Subquestion: subquestions, Old: strings.Join(oldCommon, ", "), New: strings.Join(newCommon, ", ")})
+	}
+	return changes
+}
+
+// questionPosition is the block and index within that block of a question
+type questionPosition struct {
+	blockID string
+	index   int
+}
+
+func (p questionPosition) String() string {
+	if p.blockID == "" {
+		return "survey flow"
+	}
+	return fmt.Sprintf("%s #%d", p.blockID, p.index+1)
+}
+
+// questionPositions maps each question ID to its position in the survey's blocks
+func (s *Survey) questionPositions() map[string]questionPosition {
+	positions := make(map[string]questionPosition)
+	for _, bid := range s.blockOrder {
+		for i, qid := range s.blocks[bid].QuestionIDs {
+			positions[qid] = questionPosition{bid, i}
+		}
+	}
+	return positions
+}
+
+// summary returns a short description of q, e.g., `MultipleChoiceSingleResponse "How old are you?"`
+func (q *Question) summary() string {
+	return fmt.Sprintf("%s %q", q.qType, q.Wording)
+}
+
+// notInLCS returns the elements of b that aren't part of the longest common subsequence of a and b,
+// i.e., the smallest set of elements that moved between a and b
+func notInLCS(a, b []string) []string {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	inLCS := make(map[string]bool)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i] == b[j] {
+			inLCS[b[j]] = true
+			i++
+			j++
+		} else if lengths[i+1][j] >= lengths[i][j+1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	moved := []string{}
+	for _, id := range b {
+		if !inLCS[id] {
+			moved = append(moved, id)
+		}
+	}
+	return moved
+}
+
+func contains(ids []string, id string) bool {
+	for _, s := range ids {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestDiffSurveys(t *testing.T) {
+	old, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	new, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if changes := DiffSurveys(old, new); len(changes) != 0 {
+		t.Errorf("DiffSurveys() of identical surveys = %v; want no changes", changes)
+	}
+
+	// Edit the new version
+	new.Questions["QID1"].Wording = "Pick one"
+	new.Questions["QID1"].SetExportTag("Q1_new")
+	new.Questions["QID1"].choices[0].Label = "Choice one"
+	new.Questions["QID1"].choices[1].Recode = "20"
+	new.Questions["QID1"].choices[1], new.Questions["QID1"].choices[2] = new.Questions["QID1"].choices[2], new.Questions["QID1"].choices[1]
+	if _, err = new.Questions["QID1"].AddChoice("Choice four"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	new.Questions["QID5"].subQuestions = new.Questions["QID5"].subQuestions[1:]
+	firstBlock := new.blocks[new.blockOrder[0]]
+	firstBlock.QuestionIDs = removeID(firstBlock.QuestionIDs, "QID18")
+	new.QuestionOrder = removeID(new.QuestionOrder, "QID18")
+	delete(new.Questions, "QID18")
+	ids := firstBlock.QuestionIDs
+	ids[0], ids[1] = ids[1], ids[0]
+	order := new.BlockOrder()
+	order[1], order[2] = order[2], order[1]
+	if err = new.SetBlockOrder(order); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	added, err := new.AddQuestion(order[0], TextEntry, "Brand new")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	want := []Change{
+		{Kind: BlocksReordered, Old: strings.Join(old.blockOrder, ", "), New: strings.Join(order, ", ")},
+		{Kind: QuestionRemoved, QuestionID: "QID18", Old: old.Questions["QID18"].summary()},
+		{Kind: QuestionMoved, QuestionID: "QID14", Old: order[0] + " #1", New: order[0] + " #2"},
+		{Kind: WordingChanged, QuestionID: "QID1", Old: "Single answer", New: "Pick one"},
+		{Kind: ExportTagChanged, QuestionID: "QID1", Old: "Q1", New: "Q1_new"},
+		{Kind: ChoiceLabelChanged, QuestionID: "QID1", ChoiceID: "1", Old: "Click to write Choice 1", New: "Choice one"},
+		{Kind: RecodeChanged, QuestionID: "QID1", ChoiceID: "2", Old: "2", New: "20"},
+		{Kind: ChoiceAdded, QuestionID: "QID1", ChoiceID: "5", New: "Choice four"},
+		{Kind: ChoicesReordered, QuestionID: "QID1", Old: "1, 2, 3", New: "1, 3, 2"},
+		{Kind: ChoiceRemoved, QuestionID: "QID5", ChoiceID: "1", Subquestion: true, Old: "Click to write Statement 1"},
+		{Kind: QuestionAdded, QuestionID: added.ID, New: `TextEntry "Brand new"`},
+	}
+	got := DiffSurveys(old, new)
+	for _, w := range want {
+		found := false
+		for _, c := range got {
+			if c == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing change: %s", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("len(changes) = %d; want %d", len(got), len(want))
+		for _, c := range got {
+			t.Logf("%s", c)
+		}
+	}
+}
+
+func TestDiffFlow(t *testing.T) {
+	old, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	new, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var flow qsfObject
+	for _, e := range new.qsfDoc["SurveyElements"].([]interface{}) {
+		if element := e.(qsfObject); element["Element"] == "FL" {
+			flow = element["Payload"].(qsfObject)
+		}
+	}
+	children := flow["Flow"].([]interface{})
+	data := children[0].(qsfObject)
+	data["EmbeddedData"] = append(data["EmbeddedData"].([]interface{}), qsfObject{"Type": "Custom", "Field": "group", "Value": "A"})
+	children[6].(qsfObject)["SubSet"] = 2
+	branch := qsfObject{
+		"Type":   "Branch",
+		"FlowID": "FL_13",
+		"BranchLogic": qsfObject{
+			"0": qsfObject{
+				"0":    qsfObject{"LogicType": "Question", "QuestionID": "QID1", "Description": `<span class="ConjDesc">If</span> <span class="QuestionDesc">Single answer</span> <span class="OpDesc">Is Selected</span>`},
+				"Type": "If",
+			},
+			"Type": "BooleanExpression",
+		},
+		"Flow": []interface{}{qsfObject{"Type": "EndSurvey", "FlowID": "FL_14"}},
+	}
+	flow["Flow"] = append(children, branch)
+
+	tests := []struct {
+		old, new *Survey
+		want     []Change
+	}{
+		{old, new, []Change{
+			{Kind: FlowElementChanged, FlowID: "FL_7", Old: "embedded data: s", New: "embedded data: s, group=A"},
+			{Kind: FlowElementChanged, FlowID: "FL_10", Old: "randomizer showing 1 of [BL_0CUN47YQLzzwaOx, BL_eg4Si2Q5rQhv5kN]", New: "randomizer showing 2 of [BL_0CUN47YQLzzwaOx, BL_eg4Si2Q5rQhv5kN]"},
+			{Kind: FlowElementAdded, FlowID: "FL_13", New: "branch If Single answer Is Selected: [FL_14]"},
+			{Kind: FlowElementAdded, FlowID: "FL_14", New: "end of survey (in FL_13)"},
+		}},
+		{new, old, []Change{
+			{Kind: FlowElementRemoved, FlowID: "FL_13", Old: "branch If Single answer Is Selected: [FL_14]"},
+			{Kind: FlowElementRemoved, FlowID: "FL_14", Old: "end of survey (in FL_13)"},
+			{Kind: FlowElementChanged, FlowID: "FL_7", Old: "embedded data: s, group=A", New: "embedded data: s"},
+			{Kind: FlowElementChanged, FlowID: "FL_10", Old: "randomizer showing 2 of [BL_0CUN47YQLzzwaOx, BL_eg4Si2Q5rQhv5kN]", New: "randomizer showing 1 of [BL_0CUN47YQLzzwaOx, BL_eg4Si2Q5rQhv5kN]"},
+		}},
+	}
+	for _, test := range tests {
+		got := DiffSurveys(test.old, test.new)
+		if len(got) != len(test.want) {
+			t.Errorf("DiffSurveys() = %v; want %v", got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("change %d = %s; want %s", i, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestDiffFlowWithoutFlowIDs(t *testing.T) {
+	old, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	new, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// Remove the FlowIDs of both versions' elements
+	var flows []qsfObject
+	for _, s := range []*Survey{old, new} {
+		for _, e := range s.qsfDoc["SurveyElements"].([]interface{}) {
+			if element := e.(qsfObject); element["Element"] == "FL" {
+				flow := element["Payload"].(qsfObject)
+				for _, c := range flow["Flow"].([]interface{}) {
+					delete(c.(qsfObject), "FlowID")
+				}
+				flows = append(flows, flow)
+			}
+		}
+	}
+	if changes := DiffSurveys(old, new); len(changes) != 0 {
+		t.Errorf("DiffSurveys() of identical surveys = %v; want no changes", changes)
+	}
+	children := flows[1]["Flow"].([]interface{})
+	data := children[0].(qsfObject)
+	data["EmbeddedData"] = append(data["EmbeddedData"].([]interface{}), qsfObject{"Type": "Custom", "Field": "group", "Value": "A"})
+	flows[1]["Flow"] = append(children,
+		qsfObject{"Type": "Branch", "Flow": []interface{}{qsfObject{"Type": "EndSurvey"}}},
+		qsfObject{"Type": "EndSurvey"},
+	)
+
+	want := []Change{
+		{Kind: FlowElementChanged, FlowID: "EmbeddedData 1", Old: "embedded data: s", New: "embedded data: s, group=A"},
+		{Kind: FlowElementAdded, FlowID: "Branch 1", New: "branch : [Branch 1/EndSurvey 1]"},
+		{Kind: FlowElementAdded, FlowID: "Branch 1/EndSurvey 1", New: "end of survey (in Branch 1)"},
+		{Kind: FlowElementAdded, FlowID: "EndSurvey 1", New: "end of survey"},
+	}
+	got := DiffSurveys(old, new)
+	if len(got) != len(want) {
+		t.Errorf("DiffSurveys() = %v; want %v", got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("change %d = %s; want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNotInLCS(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []string
+	}{
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, []string{}},
+		{[]string{"a", "b", "c"}, []string{"c", "a", "b"}, []string{"c"}},
+		{[]string{"a", "b", "c", "d"}, []string{"a", "c", "b", "d"}, []string{"b"}},
+		{[]string{}, []string{}, []string{}},
+	}
+	for _, test := range tests {
+		if got := notInLCS(test.a, test.b); !equalStrings(got, test.want) {
+			t.Errorf("notInLCS(%v, %v) = %v; want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func removeID(ids []string, id string) []string {
+	kept := []string{}
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
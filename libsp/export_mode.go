@@ -0,0 +1,101 @@
+package libsp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// codedAnswerKeys returns the response keys for this question that hold a single choice,
+// which Qualtrics exports as either the choice's text or its numeric value
+func (q *Question) codedAnswerKeys() []string {
+	keys := []string{}
+	if q.RColType() != "col_factor()" || !q.hasCodes(false) {
+		return keys
+	}
+	for _, s := range q.qType.internalSuffixes(q) {
+		if !strings.HasSuffix(s, "_TEXT") {
+			keys = append(keys, q.ID+s)
+		}
+	}
+	return keys
+}
+
+// choiceText returns the value Qualtrics uses for c in choice text exports
+func (c Choice) choiceText() string {
+	if c.VarName != "" {
+		return c.VarName
+	}
+	return c.Label
+}
+
+// matchAnswer reports whether a matches the text or numeric value of one of this question's choices
+func (q *Question) matchAnswer(a string) (isText bool, isCode bool) {
+	for _, c := range q.choices {
+		if a == c.Label || a == c.VarName {
+			isText = true
+		}
+		if a == c.code() {
+			isCode = true
+		}
+	}
+	return
+}
+
+// convertNumericAnswers detects whether the responses were exported as numeric values instead of
+// choice text. If so, it converts them to choice text; if the two are mixed, it returns an error.
+func (s *Survey) convertNumericAnswers() error {
+	var textExample, codeExample string
+	nText, nCode := 0, 0
+	for _, r := range s.Responses {
+		for _, id := range s.QuestionOrder {
+			q := s.Questions[id]
+			for _, k := range q.codedAnswerKeys() {
+				a := r.answers[k]
+				if a == "" || isNoResponseCode(a) {
+					continue
+				}
+				// Labels such as "1" can also be codes; only unambiguous values tell us the export format
+				isText, isCode := q.matchAnswer(a)
+				if isText && !isCode {
+					nText++
+					if textExample == "" {
+						textExample = fmt.Sprintf("%s = '%s' in response %s", k, a, r.ID)
+					}
+				} else if isCode && !isText {
+					nCode++
+					if codeExample == "" {
+						codeExample = fmt.Sprintf("%s = '%s' in response %s", k, a, r.ID)
+					}
+				}
+			}
+		}
+	}
+
+	if nCode == 0 {
+		return nil
+	}
+	if nText > 0 {
+		return fmt.Errorf("responses mix choice text (%d answers, e.g. %s) and numeric values (%d answers, e.g. %s); re-export the XML with 'Use choice text' selected", nText, textExample, nCode, codeExample)
+	}
+
+	log.Printf("responses were exported as numeric values; converting them to choice text")
+	for _, r := range s.Responses {
+		for _, id := range s.QuestionOrder {
+			q := s.Questions[id]
+			for _, k := range q.codedAnswerKeys() {
+				a := r.answers[k]
+				if a == "" || isNoResponseCode(a) {
+					continue
+				}
+				for _, c := range q.choices {
+					if a == c.code() {
+						r.answers[k] = c.choiceText()
+						break
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadXMLNumeric(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlNumericContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"QID1", "Click to write Choice 2"},
+		{"QID18", "choice2"},
+		{"QID5_1", "scale3"},
+		{"QID5_2", "-99"},
+		{"QID5_3", "scale.na"},
+		{"QID5_4", "scale1"},
+	}
+	r := s.Responses[0]
+	for _, test := range tests {
+		if r.answers[test.key] != test.want {
+			t.Errorf("answers[%s] = '%s'; want '%s'", test.key, r.answers[test.key], test.want)
+		}
+	}
+}
+
+func TestReadXMLText(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if a := s.Responses[0].answers["QID1"]; a != "Click to write Choice 1" {
+		t.Errorf("answers[QID1] = '%s'; want 'Click to write Choice 1'", a)
+	}
+}
+
+func TestReadXMLMixed(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlMixedContent)))
+	want := "responses mix choice text (1 answers, e.g. QID1 = 'Click to write Choice 1' in response R_1) and numeric values (1 answers, e.g. QID5_1 = '3' in response R_1); re-export the XML with 'Use choice text' selected"
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v; want '%s'", err, want)
+	}
+}
@@ -0,0 +1,61 @@
+package libsp
+
+import "time"
+
+// ResponseFilter returns true if r should be kept for analysis
+type ResponseFilter func(r *Response) bool
+
+// FilterResponses removes every response rejected by at least one of filters, returning the number removed
+func (s *Survey) FilterResponses(filters ...ResponseFilter) int {
+	kept := []*Response{}
+	for _, r := range s.Responses {
+		keep := true
+		for _, f := range filters {
+			if !f(r) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(s.Responses) - len(kept)
+	s.Responses = kept
+	return removed
+}
+
+// FinishedOnly keeps responses that were completed
+func FinishedOnly() ResponseFilter {
+	return func(r *Response) bool {
+		return r.Finished
+	}
+}
+
+// MinProgress keeps responses with a progress of at least p percent
+func MinProgress(p int) ResponseFilter {
+	return func(r *Response) bool {
+		return r.Progress >= p
+	}
+}
+
+// RecordedSince keeps responses recorded at or after t
+func RecordedSince(t time.Time) ResponseFilter {
+	return func(r *Response) bool {
+		return !r.RecordedOn.Before(t)
+	}
+}
+
+// RecordedUntil keeps responses recorded before t
+func RecordedUntil(t time.Time) ResponseFilter {
+	return func(r *Response) bool {
+		return r.RecordedOn.Before(t)
+	}
+}
+
+// ExcludePreviews drops survey previews and test responses
+func ExcludePreviews() ResponseFilter {
+	return func(r *Response) bool {
+		return !r.IsPreview()
+	}
+}
@@ -0,0 +1,92 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterResponses(t *testing.T) {
+	since, _ := time.Parse(timeFormat, "2019-08-20 12:45:00")
+	until, _ := time.Parse(timeFormat, "2020-01-01 00:00:00")
+
+	tests := []struct {
+		name    string
+		filters []ResponseFilter
+		want    []string
+	}{
+		{"none", nil, []string{"R_1dtWhiBDD96nfyk", "R_z72KJQMnr3lxZGp", "R_3MPTb9vwnCBmijR", "R_2EzY1K5pqRpzi0n"}},
+		{"finished", []ResponseFilter{FinishedOnly()}, []string{"R_1dtWhiBDD96nfyk", "R_z72KJQMnr3lxZGp", "R_2EzY1K5pqRpzi0n"}},
+		{"progress", []ResponseFilter{MinProgress(50)}, []string{"R_1dtWhiBDD96nfyk", "R_z72KJQMnr3lxZGp", "R_2EzY1K5pqRpzi0n"}},
+		{"window", []ResponseFilter{RecordedSince(since), RecordedUntil(until)}, []string{"R_z72KJQMnr3lxZGp", "R_3MPTb9vwnCBmijR"}},
+	}
+	for _, test := range tests {
+		s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+
+		removed := s.FilterResponses(test.filters...)
+		if removed != 4-len(test.want) {
+			t.Errorf("%s: removed = %d; want %d", test.name, removed, 4-len(test.want))
+		}
+		if len(s.Responses) != len(test.want) {
+			t.Errorf("%s: len(Responses) = %d; want %d", test.name, len(s.Responses), len(test.want))
+			continue
+		}
+		for i, id := range test.want {
+			if s.Responses[i].ID != id {
+				t.Errorf("%s: Responses[%d].ID = '%s'; want '%s'", test.name, i, s.Responses[i].ID, id)
+			}
+		}
+	}
+}
+
+func TestExcludePreviews(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlPreviewContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	if removed := s.FilterResponses(ExcludePreviews()); removed != 2 {
+		t.Errorf("removed = %d; want 2", removed)
+	}
+	if len(s.Responses) != 1 || s.Responses[0].ID != "R_1" {
+		t.Errorf("Responses = %v; want only R_1", s.Responses)
+	}
+}
+
+func TestIsPreview(t *testing.T) {
+	tests := []struct {
+		status  string
+		channel string
+		want    bool
+	}{
+		{"IP Address", "anonymous", false},
+		{"Survey Preview", "preview", true},
+		{"Survey Test", "test", true},
+		{"0", "anonymous", false},
+		{"1", "", true},
+		{"", "preview", true},
+		{"", "test", true},
+	}
+	for _, test := range tests {
+		r := NewResponse()
+		r.Status = test.status
+		r.DistributionChannel = test.channel
+		if r.IsPreview() != test.want {
+			t.Errorf("Status = '%s', DistributionChannel = '%s': IsPreview() = %t; want %t", test.status, test.channel, r.IsPreview(), test.want)
+		}
+	}
+}
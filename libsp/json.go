@@ -0,0 +1,221 @@
+package libsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// jsonSchemaVersion is incremented whenever a field of the JSON output is renamed, removed, or changes meaning
+const jsonSchemaVersion = 1
+
+// surveyJSON is the JSON representation of a Survey; see WriteJSON
+type surveyJSON struct {
+	SchemaVersion int            `json:"schema_version"`
+	ID            string         `json:"id"`
+	Title         string         `json:"title"`
+	Description   string         `json:"description,omitempty"`
+	Status        string         `json:"status,omitempty"`
+	Language      string         `json:"language,omitempty"`
+	Languages     []string       `json:"languages,omitempty"`
+	Created       string         `json:"created,omitempty"`
+	Launched      string         `json:"launched,omitempty"`
+	Modified      string         `json:"modified,omitempty"`
+	Blocks        []blockJSON    `json:"blocks"`
+	Questions     []questionJSON `json:"questions"`
+	Scoring       []scoringJSON  `json:"scoring,omitempty"`
+	Columns       []string       `json:"columns"`
+	Responses     []responseJSON `json:"responses,omitempty"`
+}
+
+type blockJSON struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	QuestionIDs []string `json:"question_ids"`
+}
+
+type questionJSON struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"`
+	ExportTag    string            `json:"export_tag,omitempty"`
+	Label        string            `json:"label,omitempty"`
+	Wording      string            `json:"wording"`
+	DataType     string            `json:"data_type,omitempty"`
+	Ordered      bool              `json:"ordered"`
+	Choices      []choiceJSON      `json:"choices,omitempty"`
+	SubQuestions []choiceJSON      `json:"subquestions,omitempty"`
+	Groups       []string          `json:"groups,omitempty"`
+	Columns      []string          `json:"columns"`
+	Translations map[string]string `json:"translations,omitempty"`
+}
+
+type choiceJSON struct {
+	ID           string             `json:"id"`
+	Label        string             `json:"label"`
+	VarName      string             `json:"var_name,omitempty"`
+	Recode       string             `json:"recode,omitempty"`
+	HasText      bool               `json:"has_text"`
+	Scores       map[string]float64 `json:"scores,omitempty"`
+	Translations map[string]string  `json:"translations,omitempty"`
+}
+
+type scoringJSON struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Column string `json:"column"`
+}
+
+type responseJSON struct {
+	ID       string             `json:"id"`
+	Finished bool               `json:"finished"`
+	Progress int                `json:"progress"`
+	Duration int                `json:"duration"`
+	Recorded string             `json:"recorded,omitempty"`
+	Metadata map[string]string  `json:"metadata,omitempty"`
+	Answers  map[string]string  `json:"answers"`
+	Scores   map[string]float64 `json:"scores,omitempty"`
+}
+
+// WriteJSON saves the survey as sp interprets it: its blocks, questions (with their choices, subquestions,
+// and CSV column names), and scoring categories, plus its responses if any have been read.
+// Questions are listed in survey order, and each response's answers are keyed by CSV column name.
+// Dates use RFC 3339. The schema_version field changes whenever the schema changes incompatibly.
+// This is sp's own schema rather than a QSF file, so it can't be read back with ReadQsf.
+func (s *Survey) WriteJSON(bw *bufio.Writer) error {
+	if bw == nil {
+		return errors.New("bw cannot be nil")
+	}
+
+	enc := json.NewEncoder(bw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.toJSON()); err != nil {
+		return fmt.Errorf("could not encode survey: %s", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not flush JSON Writer: %s", err)
+	}
+	return nil
+}
+
+// toJSON returns the survey in the form written by WriteJSON
+func (s *Survey) toJSON() surveyJSON {
+	sj := surveyJSON{
+		SchemaVersion: jsonSchemaVersion,
+		ID:            s.ID,
+		Title:         s.Title,
+		Description:   s.Description,
+		Status:        s.Status,
+		Language:      s.Language,
+		Languages:     s.Languages(),
+		Created:       formatJSONTime(s.CreatedOn),
+		Launched:      formatJSONTime(s.LaunchedOn),
+		Modified:      formatJSONTime(s.ModifiedOn),
+		Blocks:        []blockJSON{},
+		Questions:     []questionJSON{},
+		Columns:       s.csvCols(),
+	}
+	for _, id := range s.blockOrder {
+		b := s.blocks[id]
+		if b == nil {
+			continue
+		}
+		sj.Blocks = append(sj.Blocks, blockJSON{ID: b.ID, Type: b.Type, Description: b.Description, QuestionIDs: b.QuestionIDs})
+	}
+	names := s.columnNames()
+	for _, id := range s.QuestionOrder {
+		sj.Questions = append(sj.Questions, s.Questions[id].toJSON(names.questions[id]))
+	}
+	for i, c := range s.Scoring {
+		sj.Scoring = append(sj.Scoring, scoringJSON{ID: c.ID, Name: c.Name, Column: names.scoring[i]})
+	}
+	for _, r := range s.Responses {
+		sj.Responses = append(sj.Responses, s.responseToJSON(r, names))
+	}
+	return sj
+}
+
+// toJSON returns q in JSON form; cols are the names of its CSV columns
+func (q *Question) toJSON(cols []string) questionJSON {
+	qj := questionJSON{
+		ID:           q.ID,
+		Type:         q.qType.String(),
+		ExportTag:    q.dataExportTag,
+		Label:        q.label,
+		Wording:      q.Wording,
+		Ordered:      q.OrderedChoices(),
+		Choices:      choicesToJSON(q.choices),
+		SubQuestions: choicesToJSON(q.subQuestions),
+		Groups:       q.groups,
+		Columns:      cols,
+		Translations: q.translations,
+	}
+	if q.dataType != UnknownData {
+		qj.DataType = q.dataType.String()
+	}
+	return qj
+}
+
+func choicesToJSON(choices []Choice) []choiceJSON {
+	cj := []choiceJSON{}
+	for _, c := range choices {
+		cj = append(cj, choiceJSON{
+			ID:           c.ID,
+			Label:        c.Label,
+			VarName:      c.VarName,
+			Recode:       c.Recode,
+			HasText:      c.HasText,
+			Scores:       c.Scores,
+			Translations: c.Translations,
+		})
+	}
+	return cj
+}
+
+func (s *Survey) responseToJSON(r *Response, names *columnNames) responseJSON {
+	rj := responseJSON{
+		ID:       r.ID,
+		Finished: r.Finished,
+		Progress: r.Progress,
+		Duration: r.Duration,
+		Recorded: formatJSONTime(r.RecordedOn),
+		Answers:  make(map[string]string),
+	}
+	for _, mc := range s.allMetadataCols() {
+		if v := mc.value(r); v != "" {
+			if rj.Metadata == nil {
+				rj.Metadata = make(map[string]string)
+			}
+			rj.Metadata[mc.name] = v
+		}
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		cols := q.ResponseCols(r)
+		if s.NumericCodes {
+			cols = q.recodeCols(cols)
+		}
+		for i, name := range names.questions[id] {
+			if cols[i] != "" {
+				rj.Answers[name] = cols[i]
+			}
+		}
+	}
+	for i, c := range s.Scoring {
+		if rj.Scores == nil {
+			rj.Scores = make(map[string]float64)
+		}
+		rj.Scores[names.scoring[i]] = s.Score(r, c.ID)
+	}
+	return rj
+}
+
+// formatJSONTime returns t in RFC 3339 format, or an empty string if t is not set
+func formatJSONTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
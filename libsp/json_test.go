@@ -0,0 +1,98 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteJSON(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var sj surveyJSON
+	if err = json.Unmarshal(b.Bytes(), &sj); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if sj.SchemaVersion != jsonSchemaVersion {
+		t.Errorf("schema_version = %d; want %d", sj.SchemaVersion, jsonSchemaVersion)
+	}
+	if sj.Title != "Test survey" {
+		t.Errorf("title = '%s'; want 'Test survey'", sj.Title)
+	}
+	if len(sj.Questions) != len(s.QuestionOrder) {
+		t.Errorf("len(questions) = %d; want %d", len(sj.Questions), len(s.QuestionOrder))
+		return
+	}
+	if len(sj.Responses) != 0 {
+		t.Errorf("len(responses) = %d; want 0", len(sj.Responses))
+	}
+	for i, qj := range sj.Questions {
+		if qj.ID != s.QuestionOrder[i] {
+			t.Errorf("questions[%d].id = %s; want %s", i, qj.ID, s.QuestionOrder[i])
+		}
+	}
+
+	var q1 questionJSON
+	for _, qj := range sj.Questions {
+		if qj.ID == "QID1" {
+			q1 = qj
+		}
+	}
+	if q1.Type != "MultipleChoiceSingleResponse" || q1.ExportTag != "Q1" || len(q1.Choices) != 3 {
+		t.Errorf("QID1 = %+v", q1)
+	} else if q1.Choices[0].Label != "Click to write Choice 1" {
+		t.Errorf("QID1 choices[0].label = '%s'; want 'Click to write Choice 1'", q1.Choices[0].Label)
+	}
+	if strings.Join(q1.Columns, ",") != "Q1Label" {
+		t.Errorf("QID1 columns = %v; want [Q1Label]", q1.Columns)
+	}
+
+	// Responses are included once they've been read
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	b.Reset()
+	if err = s.WriteJSON(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	sj = surveyJSON{}
+	if err = json.Unmarshal(b.Bytes(), &sj); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if len(sj.Responses) != 4 {
+		t.Errorf("len(responses) = %d; want 4", len(sj.Responses))
+		return
+	}
+	r := sj.Responses[0]
+	if r.ID != "R_1dtWhiBDD96nfyk" || !r.Finished || r.Recorded != "2019-08-20T12:44:31Z" {
+		t.Errorf("responses[0] = %+v", r)
+	}
+	if got := r.Answers["Q1Label"]; got != "Click to write Choice 1" {
+		t.Errorf("responses[0].answers[Q1Label] = '%s'; want 'Click to write Choice 1'", got)
+	}
+	if _, ok := r.Answers["Q18Label"]; ok {
+		t.Errorf("responses[0].answers[Q18Label] is set; want unanswered columns omitted")
+	}
+}
+
+func TestWriteJSONNil(t *testing.T) {
+	s := new(Survey)
+	err := s.WriteJSON(nil)
+	if err == nil || err.Error() != "bw cannot be nil" {
+		t.Errorf("err = %v; want err = 'bw cannot be nil'", err)
+	}
+}
@@ -0,0 +1,178 @@
+package libsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Languages returns the codes of every language this survey has been translated to, including its default language
+func (s *Survey) Languages() []string {
+	found := make(map[string]bool)
+	if s.Language != "" {
+		found[s.Language] = true
+	}
+	for _, q := range s.Questions {
+		for lang := range q.translations {
+			found[lang] = true
+		}
+	}
+	langs := []string{}
+	for lang := range found {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// SetLanguage selects the language used for question wording, choice labels, and answers in output.
+// Pass the survey's default language or an empty string to use the original text.
+func (s *Survey) SetLanguage(lang string) error {
+	lang = strings.ToUpper(lang)
+	if lang == s.Language {
+		lang = ""
+	}
+	if lang != "" {
+		known := false
+		for _, l := range s.Languages() {
+			if l == lang {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("survey has no '%s' translation (found %s)", lang, strings.Join(s.Languages(), ", "))
+		}
+	}
+	for _, q := range s.Questions {
+		q.language = lang
+	}
+	return nil
+}
+
+// Translation returns this question's wording in the given language, or its original wording if it has no such translation
+func (q *Question) Translation(lang string) string {
+	if t, ok := q.translations[strings.ToUpper(lang)]; ok && t != "" {
+		return t
+	}
+	return q.Wording
+}
+
+// translatedLabel returns c's label in the given language, or its original label if it has no such translation
+func (c Choice) translatedLabel(lang string) string {
+	if t, ok := c.Translations[lang]; ok && t != "" {
+		return t
+	}
+	return c.Label
+}
+
+// translateAnswer converts an answer holding a choice's original label to the selected language
+func (q *Question) translateAnswer(a string) string {
+	if q.language == "" || a == "" {
+		return a
+	}
+	for _, c := range q.choices {
+		if c.Label == a {
+			return c.translatedLabel(q.language)
+		}
+	}
+	return a
+}
+
+// canonicalizeAnswers converts any answers given as translated choice labels back to the original labels,
+// so each choice is represented by the same value regardless of the respondent's language
+func (s *Survey) canonicalizeAnswers(r *Response) {
+	for id, a := range r.answers {
+		if a == "" || strings.HasSuffix(id, "_TEXT") {
+			continue
+		}
+		qid := id
+		if i := strings.Index(id, "_"); i > 0 {
+			qid = id[:i]
+		}
+		q, ok := s.Questions[qid]
+		if !ok || len(q.translations) == 0 {
+			continue
+		}
+		r.answers[id] = q.canonicalLabel(a)
+	}
+}
+
+// canonicalLabel returns the original label of the choice whose label or translated label is a
+func (q *Question) canonicalLabel(a string) string {
+	for _, c := range q.choices {
+		if c.Label == a {
+			return a
+		}
+	}
+	for _, c := range q.choices {
+		for _, t := range c.Translations {
+			if t == a {
+				return c.Label
+			}
+		}
+	}
+	return a
+}
+
+// addTranslations stores the translated wording and choice labels found in the question's payload
+func (q *Question) addTranslations(translations map[string]*qsfTranslation) {
+	if len(translations) == 0 {
+		return
+	}
+	q.translations = make(map[string]string)
+	for lang, t := range translations {
+		q.translations[lang] = t.QuestionText
+		if q.qType.choicesAreQuestions() {
+			translateChoices(q.subQuestions, lang, t.Choices)
+			translateChoices(q.choices, lang, t.Answers)
+		} else {
+			translateChoices(q.choices, lang, t.Choices)
+		}
+	}
+}
+
+func translateChoices(choices []Choice, lang string, translated map[string]qsfChoice) {
+	for i, c := range choices {
+		t, ok := translated[c.ID]
+		if !ok || t.Display == "" {
+			continue
+		}
+		if choices[i].Translations == nil {
+			choices[i].Translations = make(map[string]string)
+		}
+		choices[i].Translations[lang] = t.Display
+	}
+}
+
+type qsfTranslation struct {
+	QuestionText string
+	Choices      map[string]qsfChoice
+	Answers      map[string]qsfChoice
+}
+
+// Translations returns the question's translations, keyed by language code
+func (p *qsfPayload) Translations() map[string]*qsfTranslation {
+	translations := make(map[string]*qsfTranslation)
+	if len(p.Language) == 0 {
+		return translations
+	}
+	// Untranslated questions use an empty array instead of an object
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(p.Language, &raw); err != nil {
+		return translations
+	}
+	for lang, b := range raw {
+		var t qsfTranslation
+		if err := json.Unmarshal(b, &t); err != nil {
+			// Choices can be arrays too (e.g., NPS questions); keep the wording
+			var wording struct{ QuestionText string }
+			if err := json.Unmarshal(b, &wording); err != nil {
+				continue
+			}
+			t.QuestionText = wording.QuestionText
+		}
+		translations[lang] = &t
+	}
+	return translations
+}
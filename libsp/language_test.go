@@ -0,0 +1,99 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func readTranslatedSurvey(t *testing.T) *Survey {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTranslatedContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTranslatedContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	return s
+}
+
+func TestReadQsfTranslations(t *testing.T) {
+	s := readTranslatedSurvey(t)
+	if s == nil {
+		return
+	}
+	langs := s.Languages()
+	if len(langs) != 2 || langs[0] != "DE" || langs[1] != "EN" {
+		t.Errorf("Languages() = %v; want [DE EN]", langs)
+	}
+	if w := s.Questions["QID1"].Translation("DE"); w != "Ist der Himmel blau?" {
+		t.Errorf("Questions[QID1].Translation(DE) = '%s'; want 'Ist der Himmel blau?'", w)
+	}
+	if w := s.Questions["QID1"].Translation("FR"); w != "Is the sky blue?" {
+		t.Errorf("Questions[QID1].Translation(FR) = '%s'; want 'Is the sky blue?'", w)
+	}
+	if l := s.Questions["QID2"].SubQuestions()[1].Translations["DE"]; l != "Birnen" {
+		t.Errorf("Questions[QID2].SubQuestions()[1].Translations[DE] = '%s'; want 'Birnen'", l)
+	}
+	if l := s.Questions["QID2"].ResponseChoices()[1].Translations["DE"]; l != "Gar nicht" {
+		t.Errorf("Questions[QID2].ResponseChoices()[1].Translations[DE] = '%s'; want 'Gar nicht'", l)
+	}
+}
+
+func TestWriteCSVLanguage(t *testing.T) {
+	tests := []struct {
+		lang string
+		want [][]string
+	}{
+		{"", [][]string{
+			{"R_1", "Yes", "A lot", "Not at all"},
+			{"R_2", "No", "A lot", "A lot"},
+		}},
+		{"DE", [][]string{
+			{"R_1", "Ja", "Sehr", "Gar nicht"},
+			{"R_2", "Nein", "Sehr", "Sehr"},
+		}},
+	}
+	for _, test := range tests {
+		s := readTranslatedSurvey(t)
+		if s == nil {
+			return
+		}
+		if err := s.SetLanguage(test.lang); err != nil {
+			t.Errorf("err = %s", err)
+		}
+		var b bytes.Buffer
+		if err := s.WriteCSV(bufio.NewWriter(&b)); err != nil {
+			t.Errorf("err = %s", err)
+		}
+		records, err := csv.NewReader(&b).ReadAll()
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		for i, want := range test.want {
+			record := records[i+1]
+			got := []string{record[0], record[5], record[6], record[7]}
+			for j := range want {
+				if got[j] != want[j] {
+					t.Errorf("lang '%s', row %d, col %d = '%s'; want '%s'", test.lang, i+1, j, got[j], want[j])
+				}
+			}
+		}
+	}
+}
+
+func TestSetUnknownLanguage(t *testing.T) {
+	s := readTranslatedSurvey(t)
+	if s == nil {
+		return
+	}
+	err := s.SetLanguage("FR")
+	if err == nil || err.Error() != "survey has no 'FR' translation (found DE, EN)" {
+		t.Errorf("err = %v; want 'survey has no 'FR' translation (found DE, EN)'", err)
+	}
+}
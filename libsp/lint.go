@@ -0,0 +1,257 @@
+package libsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Severity of a LintIssue
+type Severity string
+
+// Lint severities. Errors produce broken or ambiguous data; warnings make analysis harder.
+const (
+	LintError   Severity = "error"
+	LintWarning Severity = "warning"
+)
+
+// Lint rules reported by Survey.Lint
+const (
+	RuleMissingExportTag      = "missing-export-tag"
+	RuleDuplicateExportTag    = "duplicate-export-tag"
+	RuleDuplicateVarName      = "duplicate-var-name"
+	RuleColumnCollision       = "column-collision"
+	RuleInvalidColumnName     = "invalid-column-name"
+	RuleInconsistentRecodes   = "inconsistent-recodes"
+	RuleTrashedQuestion       = "trashed-question"
+	RuleUnusedEmbeddedData    = "unused-embedded-data"
+	RuleWhitespaceChoiceLabel = "whitespace-choice-label"
+)
+
+// LintIssue describes a survey design problem that makes its data harder to analyze
+type LintIssue struct {
+	Rule       string   `json:"rule"`
+	Severity   Severity `json:"severity"`
+	QuestionID string   `json:"question_id,omitempty"`
+	Message    string   `json:"message"`
+}
+
+// String returns a human-readable description of i
+func (i LintIssue) String() string {
+	if i.QuestionID == "" {
+		return fmt.Sprintf("%s: %s [%s]", i.Severity, i.Message, i.Rule)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", i.Severity, i.QuestionID, i.Message, i.Rule)
+}
+
+// Lint checks the survey for design problems that hurt analysis: missing and duplicate export tags,
+// duplicate choice variable names, CSV column names used more than once or not valid in R, questions with the same scale
+// but different recode values, questions left in the trash, unused embedded data, and choice labels
+// that differ only by whitespace. Issues are grouped by check rather than sorted by position in the survey;
+// variable name and whitespace issues are found in a single pass, so they're listed question by question.
+func (s *Survey) Lint() []LintIssue {
+	issues := []LintIssue{}
+	issues = append(issues, s.lintExportTags()...)
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		issues = append(issues, q.lintVarNames()...)
+		issues = append(issues, q.lintWhitespace()...)
+	}
+	issues = append(issues, s.lintColumns()...)
+	issues = append(issues, s.lintRecodes()...)
+	issues = append(issues, s.lintTrash()...)
+	issues = append(issues, s.lintEmbeddedData()...)
+	return issues
+}
+
+func (s *Survey) lintExportTags() []LintIssue {
+	issues := []LintIssue{}
+	tags := make(map[string][]string)
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if q.qType == Embedded {
+			continue
+		}
+		if q.dataExportTag == "" {
+			issues = append(issues, LintIssue{RuleMissingExportTag, LintError, q.ID, "question has no export tag"})
+			continue
+		}
+		tags[q.dataExportTag] = append(tags[q.dataExportTag], q.ID)
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if ids := tags[q.dataExportTag]; len(ids) > 1 && ids[0] == q.ID {
+			issues = append(issues, LintIssue{RuleDuplicateExportTag, LintError, q.ID,
+				fmt.Sprintf("export tag '%s' is also used by %s", q.dataExportTag, strings.Join(ids[1:], ", "))})
+		}
+	}
+	return issues
+}
+
+func (q *Question) lintVarNames() []LintIssue {
+	issues := []LintIssue{}
+	for _, choices := range [][]Choice{q.subQuestions, q.choices} {
+		seen := make(map[string]string)
+		for _, c := range choices {
+			if c.VarName == "" {
+				continue
+			}
+			if other, ok := seen[c.VarName]; ok {
+				issues = append(issues, LintIssue{RuleDuplicateVarName, LintError, q.ID,
+					fmt.Sprintf("choices %s and %s both use the variable name '%s'", other, c.ID, c.VarName)})
+				continue
+			}
+			seen[c.VarName] = c.ID
+		}
+	}
+	return issues
+}
+
+func (q *Question) lintWhitespace() []LintIssue {
+	issues := []LintIssue{}
+	for _, choices := range [][]Choice{q.subQuestions, q.choices} {
+		seen := make(map[string]Choice)
+		for _, c := range choices {
+			normalized := strings.Join(strings.Fields(c.Label), " ")
+			if other, ok := seen[normalized]; ok && other.Label != c.Label {
+				issues = append(issues, LintIssue{RuleWhitespaceChoiceLabel, LintWarning, q.ID,
+					fmt.Sprintf("choices %s (%q) and %s (%q) differ only by whitespace", other.ID, other.Label, c.ID, c.Label)})
+				continue
+			}
+			seen[normalized] = c
+		}
+	}
+	return issues
+}
+
+// lintColumns reports the columns that the writers rename, as RenamedColumns does: names chosen by the survey's
+// NamingStrategy and overrides that are already used by another column, or that aren't valid in R
+func (s *Survey) lintColumns() []LintIssue {
+	issues := []LintIssue{}
+	for _, r := range s.columnNames().renamed {
+		msg := r.message()
+		if r.questionID == "" {
+			msg = r.owner + ": " + msg
+		}
+		if r.usedBy == "" {
+			issues = append(issues, LintIssue{RuleInvalidColumnName, LintWarning, r.questionID, msg})
+			continue
+		}
+		issues = append(issues, LintIssue{RuleColumnCollision, LintError, r.questionID, msg})
+	}
+	return issues
+}
+
+// lintRecodes reports questions that share a scale (the same choice labels, in the same order) but use different recode values
+func (s *Survey) lintRecodes() []LintIssue {
+	issues := []LintIssue{}
+	scales := make(map[string][]*Question)
+	scaleOrder := []string{}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if q.RColType() != "col_factor()" || !q.hasCodes(false) || len(q.choices) < 2 {
+			continue
+		}
+		scaleID := choiceScaleID(q.choices)
+		if _, ok := scales[scaleID]; !ok {
+			scaleOrder = append(scaleOrder, scaleID)
+		}
+		scales[scaleID] = append(scales[scaleID], q)
+	}
+	for _, scaleID := range scaleOrder {
+		questions := scales[scaleID]
+		first := questions[0]
+		for _, q := range questions[1:] {
+			if codeScaleID(q.choices) != codeScaleID(first.choices) {
+				issues = append(issues, LintIssue{RuleInconsistentRecodes, LintWarning, q.ID,
+					fmt.Sprintf("recode values (%s) differ from those of %s (%s), which has the same choices", choiceCodes(q.choices), first.ID, choiceCodes(first.choices))})
+			}
+		}
+	}
+	return issues
+}
+
+func choiceCodes(choices []Choice) string {
+	codes := []string{}
+	for _, c := range choices {
+		codes = append(codes, c.code())
+	}
+	return strings.Join(codes, ", ")
+}
+
+func (s *Survey) lintTrash() []LintIssue {
+	issues := []LintIssue{}
+	ids := []string{}
+	for _, b := range s.blocks {
+		if b.Type == "Trash" {
+			ids = append(ids, b.QuestionIDs...)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		issues = append(issues, LintIssue{RuleTrashedQuestion, LintWarning, id, "question is in the trash; delete it or restore it to a block"})
+	}
+	return issues
+}
+
+// lintEmbeddedData reports embedded data fields that the survey flow never assigns a value to,
+// and that no question or logic refers to
+func (s *Survey) lintEmbeddedData() []LintIssue {
+	issues := []LintIssue{}
+	if s.qsfDoc == nil {
+		return issues
+	}
+	assigned := make(map[string]bool)
+	elements, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	for _, e := range elements {
+		if element, ok := e.(qsfObject); ok && element["Element"] == "FL" {
+			if flow, ok := element["Payload"].(qsfObject); ok {
+				findAssignedFields(flow, assigned)
+			}
+		}
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s.qsfDoc); err != nil {
+		return issues
+	}
+	doc := b.String()
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if q.qType != Embedded || assigned[q.ID] {
+			continue
+		}
+		if strings.Contains(doc, "e://Field/"+q.ID) || strings.Contains(doc, "e://Field/"+url.PathEscape(q.ID)) ||
+			strings.Contains(doc, `"LeftOperand":"`+q.ID+`"`) {
+			continue
+		}
+		issues = append(issues, LintIssue{RuleUnusedEmbeddedData, LintWarning, q.ID,
+			"embedded data field is never assigned a value or used by the survey (ignore this if it's set by the survey link or contact list)"})
+	}
+	return issues
+}
+
+// findAssignedFields records the embedded data fields given a value anywhere in flow
+func findAssignedFields(flow qsfObject, assigned map[string]bool) {
+	if flow["Type"] == "EmbeddedData" {
+		fields, _ := flow["EmbeddedData"].([]interface{})
+		for _, f := range fields {
+			if field, ok := f.(qsfObject); ok {
+				name, _ := field["Field"].(string)
+				if value, _ := field["Value"].(string); value != "" {
+					assigned[name] = true
+				}
+			}
+		}
+	}
+	children, _ := flow["Flow"].([]interface{})
+	for _, c := range children {
+		if child, ok := c.(qsfObject); ok {
+			findAssignedFields(child, assigned)
+		}
+	}
+}
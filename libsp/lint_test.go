@@ -0,0 +1,118 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.Questions["QID18"].dataExportTag = ""
+	s.Questions["QID3"].SetExportTag("Q1")
+	s.Questions["QID3"].label = "Q1Label"
+	s.Questions["QID3"].choices[0].Recode = "10"
+	s.Questions["QID19"].choices[1].VarName = "choice1"
+	s.Questions["QID11"].choices[1].Label = " " + s.Questions["QID11"].choices[0].Label
+
+	tests := []struct {
+		rule       string
+		severity   Severity
+		questionID string
+	}{
+		{RuleMissingExportTag, LintError, "QID18"},
+		{RuleDuplicateExportTag, LintError, "QID1"},
+		{RuleDuplicateVarName, LintError, "QID19"},
+		{RuleWhitespaceChoiceLabel, LintWarning, "QID11"},
+		{RuleColumnCollision, LintError, "QID3"},
+		{RuleColumnCollision, LintError, "QID19"}, // the duplicate variable name also duplicates a column
+		{RuleInconsistentRecodes, LintWarning, "QID3"},
+		{RuleTrashedQuestion, LintWarning, "QID12"},
+		{RuleTrashedQuestion, LintWarning, "QID2"},
+		{RuleUnusedEmbeddedData, LintWarning, "s"},
+	}
+	issues := s.Lint()
+	if len(issues) != len(tests) {
+		t.Errorf("len(Lint()) = %d; want %d", len(issues), len(tests))
+		for _, i := range issues {
+			t.Logf("%s", i)
+		}
+		return
+	}
+	for i, test := range tests {
+		if issues[i].Rule != test.rule || issues[i].Severity != test.severity || issues[i].QuestionID != test.questionID {
+			t.Errorf("Lint()[%d] = %s; want %s %s for %s", i, issues[i], test.severity, test.rule, test.questionID)
+		}
+	}
+	if want := "column 'Q1Label' is already used by QID1; renamed to 'Q1Label.1'"; issues[4].Message != want {
+		t.Errorf("Lint()[4].Message = '%s'; want '%s'", issues[4].Message, want)
+	}
+	if want := "column 'Q19_choice1' is already used by QID19; renamed to 'Q19_choice1.1'"; issues[5].Message != want {
+		t.Errorf("Lint()[5].Message = '%s'; want '%s'", issues[5].Message, want)
+	}
+}
+
+func TestLintColumns(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeMetadata bool
+		naming          NamingStrategy
+		label           string // QID1's label
+		want            []string
+	}{
+		{"no issues", false, nil, "Q1Label", []string{}},
+		{"metadata names are free", false, nil, "status", []string{}},
+		{"metadata names are used", true, nil, "status",
+			[]string{"error: QID1: column 'status' is already used by response metadata; renamed to 'status.1' [column-collision]"}},
+		{"invalid name", false, nil, "1st",
+			[]string{"warning: QID1: column '1st' is not a valid R name; renamed to 'X1st' [invalid-column-name]"}},
+		{"default names", false, nil, "Q3Label",
+			[]string{"error: QID3: column 'Q3Label' is already used by QID1; renamed to 'Q3Label.1' [column-collision]"}},
+		{"naming strategy", false, ExportTagNaming{}, "Q3Label", []string{}},
+	}
+	for _, test := range tests {
+		s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		s.IncludeMetadata = test.includeMetadata
+		s.Naming = test.naming
+		s.Questions["QID1"].label = test.label
+		got := []string{}
+		for _, issue := range s.lintColumns() {
+			got = append(got, issue.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: lintColumns() = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLintEmbeddedData(t *testing.T) {
+	s := NewSurvey("Lint")
+	bid := s.AddBlock("Block")
+	if _, err := s.AddQuestion(bid, TextEntry, "Hello ${e://Field/first%20name}"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, field := range []string{"first name", "unused"} {
+		if _, err := s.AddEmbeddedData(field, TextData); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+	}
+	// Embedded data is only added to the QSF document when the survey is written
+	if err := s.WriteQsf(bufio.NewWriter(&strings.Builder{})); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	issues := s.Lint()
+	if len(issues) != 1 || issues[0].Rule != RuleUnusedEmbeddedData || issues[0].QuestionID != "unused" {
+		t.Errorf("Lint() = %v; want unused-embedded-data for unused", issues)
+	}
+}
@@ -0,0 +1,168 @@
+package libsp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+)
+
+// longCol describes what a single CSV column of a question holds, for long-format output
+type longCol struct {
+	subquestion string
+	choice      string
+}
+
+// longText is the subquestion of a column holding the text entered with a choice,
+// and the choice of a column holding the text entered with a subquestion
+const longText = "text"
+
+// WriteLongCSV saves the survey responses in long (tidy) comma-separated value format,
+// with one row per respondent and question column. Columns without a value have an empty value and label.
+func (s *Survey) WriteLongCSV(bw *bufio.Writer) error {
+	if bw == nil {
+		return errors.New("bw cannot be nil")
+	}
+
+	w := csv.NewWriter(bw)
+	err := w.Write([]string{"id", "question_id", "question_type", "subquestion", "choice", "value", "label"})
+	if err != nil {
+		return fmt.Errorf("could not write CSV columns: %s", err)
+	}
+	for _, r := range s.Responses {
+		for _, id := range s.QuestionOrder {
+			q := s.Questions[id]
+			cols := q.ResponseCols(r)
+			if s.NumericCodes {
+				cols = q.recodeCols(cols)
+			}
+			details := q.longCols()
+			for i, colID := range q.CSVCols() {
+				label := ""
+				if rColType, isRankCol := getColType(colID, q); rColType == "col_factor()" && q.hasCodes(isRankCol) {
+					label = q.labelForAnswer(cols[i])
+				}
+				row := []string{r.ID, q.ID, q.qType.String(), details[i].subquestion, details[i].choice, cols[i], label}
+				if err = w.Write(row); err != nil {
+					return fmt.Errorf("could not write CSV row: %s", err)
+				}
+			}
+		}
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing csv: %s", err)
+	}
+
+	return nil
+}
+
+// WriteLongR saves an R script suitable for importing the output of WriteLongCSV to R
+func (s *Survey) WriteLongR(w *bufio.Writer, csvPath string) error {
+	if w == nil {
+		return errors.New("w cannot be nil")
+	}
+
+	script := `# Generated by sp ` + Version + ` (https://github.com/fflewddur/sp)
+library(tidyverse)
+
+input_path <- "` + csvPath + `"
+
+message(sprintf("Reading %s...", input_path))
+data <- read_csv(input_path, col_types = cols(
+	id = col_character(),
+	question_id = col_character(),
+	question_type = col_factor(),
+	subquestion = col_character(),
+	choice = col_character(),
+	value = col_character(),
+	label = col_character()
+))
+
+rm(input_path)
+`
+	_, err := w.WriteString(script)
+	if err != nil {
+		return fmt.Errorf("could not write R script: %s", err)
+	}
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush R Writer: %s", err)
+	}
+
+	return nil
+}
+
+// labelForAnswer returns the label of the choice whose label, variable name, or code is a
+func (q *Question) labelForAnswer(a string) string {
+	for _, c := range q.ResponseChoices() {
+		if a == c.Label || a == c.VarName || a == c.code() {
+			return c.Label
+		}
+	}
+	if a == noResponseConst || a == noResponseCode {
+		return noResponseConst
+	}
+	return ""
+}
+
+// longCols returns the subquestion and choice held by each of this question's CSV columns,
+// in the same order as CSVCols()
+func (q *Question) longCols() []longCol {
+	cols := []longCol{}
+	choices := q.ResponseChoices()
+	subQuestions := q.SubQuestions()
+	switch q.qType {
+	case PickGroupRank:
+		for _, c := range choices {
+			cols = append(cols, longCol{"group", c.Label}, longCol{"rank", c.Label})
+			if c.HasText {
+				cols = append(cols, longCol{longText, c.Label})
+			}
+		}
+	case Form, MaxDiff, MultipleChoiceMultiResponse, RankOrder:
+		for _, c := range choices {
+			cols = append(cols, longCol{"", c.Label})
+			if c.HasText {
+				cols = append(cols, longCol{longText, c.Label})
+			}
+		}
+	case MatrixMultiResponse:
+		for _, sq := range subQuestions {
+			for _, c := range choices {
+				cols = append(cols, longCol{sq.Label, c.Label})
+			}
+			if sq.HasText {
+				cols = append(cols, longCol{sq.Label, longText})
+			}
+		}
+	case ConstantSum, MatrixSingleResponse:
+		for _, sq := range subQuestions {
+			cols = append(cols, longCol{sq.Label, ""})
+			if sq.HasText {
+				cols = append(cols, longCol{sq.Label, longText})
+			}
+		}
+	case MultipleChoiceSingleResponse:
+		cols = append(cols, longCol{})
+		for _, c := range choices {
+			if c.HasText {
+				cols = append(cols, longCol{longText, c.Label})
+			}
+		}
+	case Meta:
+		for _, f := range metaFields {
+			if !f.optional || q.hasChoiceLabel(f.label) {
+				cols = append(cols, longCol{f.label, ""})
+			}
+		}
+	case NPS:
+		cols = append(cols, longCol{}, longCol{"group", ""})
+	case Timing:
+		cols = append(cols, longCol{"First Click", ""}, longCol{"Last Click", ""}, longCol{"Page Submit", ""}, longCol{"Click Count", ""})
+	case Embedded, TextEntry:
+		cols = append(cols, longCol{})
+	}
+	return cols
+}
@@ -0,0 +1,146 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestLongColsMatchCSVCols(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if len(q.longCols()) != len(q.CSVCols()) {
+			t.Errorf("Questions[%s]: len(longCols()) = %d; want %d", id, len(q.longCols()), len(q.CSVCols()))
+		}
+	}
+}
+
+func TestWriteLongCSV(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteLongCSV(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	if want := []string{"id", "question_id", "question_type", "subquestion", "choice", "value", "label"}; !equalStrings(records[0], want) {
+		t.Errorf("header = %v; want %v", records[0], want)
+	}
+	tests := [][]string{
+		{"R_1dtWhiBDD96nfyk", "QID22", "Meta", "Browser", "", "", ""},
+		{"R_1dtWhiBDD96nfyk", "QID1", "MultipleChoiceSingleResponse", "", "", "Click to write Choice 1", "Click to write Choice 1"},
+		{"R_1dtWhiBDD96nfyk", "QID18", "MultipleChoiceSingleResponse", "", "", "", ""},
+		{"R_1dtWhiBDD96nfyk", "QID3", "MultipleChoiceSingleResponse", "", "", "Click to write Choice 2", "Click to write Choice 2"},
+		{"R_1dtWhiBDD96nfyk", "QID4", "MultipleChoiceMultiResponse", "", "Click to write Choice 1", "FALSE", ""},
+	}
+	for _, test := range tests {
+		found := false
+		for _, record := range records {
+			if record[0] == test[0] && record[1] == test[1] && record[3] == test[3] && record[4] == test[4] {
+				found = true
+				if !equalStrings(record, test) {
+					t.Errorf("record = %v; want %v", record, test)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("no row found for %v", test)
+		}
+	}
+
+	// Every respondent has a row for every question column, even if it's empty
+	nCols := 0
+	for _, id := range s.QuestionOrder {
+		nCols += len(s.Questions[id].CSVCols())
+	}
+	if want := 1 + len(s.Responses)*nCols; len(records) != want {
+		t.Errorf("len(records) = %d; want %d", len(records), want)
+	}
+
+	found := false
+	for _, record := range records {
+		if record[0] == "R_1dtWhiBDD96nfyk" && record[1] == "QID5" && record[3] == "Click to write Statement 2" {
+			found = true
+			if record[5] != "scale2" || record[6] != "Click to write Scale point 2" {
+				t.Errorf("QID5 statement 2 = %v; want value 'scale2' and label 'Click to write Scale point 2'", record)
+			}
+		}
+	}
+	if !found {
+		t.Error("no row found for QID5 statement 2")
+	}
+}
+
+func TestWriteLongCSVText(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteLongCSV(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	// Text entered with a choice or subquestion has its own row, apart from the row for its selection
+	tests := []struct {
+		questionID  string
+		subquestion string
+		choice      string
+		want        string
+	}{
+		{"QID4", "", "Other1", "TRUE"},
+		{"QID4", "text", "Other1", "other response 1"},
+		{"QID4", "text", "Other2", "other response 2"},
+		{"QID5", "Other:", "", "scale3"},
+		{"QID5", "Other:", "text", "other matrix row"},
+		{"QID13", "Other:", "text", "other matrix multiple row"},
+	}
+	for _, test := range tests {
+		values := []string{}
+		for _, record := range records {
+			if record[0] == "R_1dtWhiBDD96nfyk" && record[1] == test.questionID && record[3] == test.subquestion && record[4] == test.choice {
+				values = append(values, record[5])
+			}
+		}
+		if len(values) != 1 || values[0] != test.want {
+			t.Errorf("%s (%s, %s) values = %q; want ['%s']", test.questionID, test.subquestion, test.choice, values, test.want)
+		}
+	}
+}
+
+func TestWriteLongCSVNil(t *testing.T) {
+	s := new(Survey)
+	err := s.WriteLongCSV(nil)
+	if err == nil || err.Error() != "bw cannot be nil" {
+		t.Errorf("err = %v; want err = 'bw cannot be nil'", err)
+	}
+}
@@ -0,0 +1,444 @@
+package libsp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Wave is one version of a survey, with its responses, to combine with other waves using MergeWaves
+type Wave struct {
+	Name   string // identifies this wave's responses in the merged data
+	Survey *Survey
+}
+
+// MergeKey selects how MergeWaves matches questions across waves
+type MergeKey int
+
+// Ways of matching questions across waves
+const (
+	MergeByExportTag MergeKey = iota // match questions by export tag, or by ID if they don't have one
+	MergeByID                        // match questions by question ID
+)
+
+// WaveColumn is the name of the column MergeWaves adds to record which wave each response came from
+const WaveColumn = "wave"
+
+// MergeReport describes how MergeWaves combined a set of waves
+type MergeReport struct {
+	Waves   []string          // names of the merged waves, in order
+	Partial []PartialQuestion // questions that weren't asked in every wave
+}
+
+// PartialQuestion is a question that exists in only some of the merged waves
+type PartialQuestion struct {
+	QuestionID string   // ID of the question in the merged survey
+	Key        string   // export tag or ID used to match the question across waves
+	Waves      []string // names of the waves that include the question
+}
+
+// String returns a human-readable summary of r
+func (r *MergeReport) String() string {
+	if len(r.Partial) == 0 {
+		return fmt.Sprintf("All questions are in each of the %d waves", len(r.Waves))
+	}
+	lines := []string{fmt.Sprintf("%d questions are only in some of the %d waves:", len(r.Partial), len(r.Waves))}
+	for _, p := range r.Partial {
+		lines = append(lines, fmt.Sprintf("\t%s (%s): %s", p.Key, p.QuestionID, strings.Join(p.Waves, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mergedQuestion tracks a question of the merged survey and the question it replaces in each wave
+type mergedQuestion struct {
+	key     string
+	q       *Question
+	sources map[int]*Question // keyed by wave index
+}
+
+// MergeWaves combines several versions of a survey and their responses into a single survey.
+// Questions are matched across waves using key; the merged survey holds every question from every wave,
+// with the wording and column names of its most recent wave, and the choices from all of its waves.
+// Each response's wave name is recorded in a new WaveColumn column.
+func MergeWaves(waves []Wave, key MergeKey) (*Survey, *MergeReport, error) {
+	if len(waves) == 0 {
+		return nil, nil, errors.New("no waves to merge")
+	}
+	names := make(map[string]bool)
+	for _, w := range waves {
+		if w.Survey == nil {
+			return nil, nil, fmt.Errorf("wave '%s' has no survey", w.Name)
+		}
+		if w.Name == "" || names[w.Name] {
+			return nil, nil, fmt.Errorf("waves need unique names, found '%s'", w.Name)
+		}
+		names[w.Name] = true
+		if _, ok := w.Survey.Questions[WaveColumn]; ok {
+			return nil, nil, fmt.Errorf("wave '%s' already has a question or field named '%s'", w.Name, WaveColumn)
+		}
+	}
+
+	// Match questions, starting with the most recent wave so that merged questions follow its order
+	byKey := make(map[string]*mergedQuestion)
+	order := []string{}
+	for wi := len(waves) - 1; wi >= 0; wi-- {
+		s := waves[wi].Survey
+		prev := -1
+		for _, id := range s.QuestionOrder {
+			q := s.Questions[id]
+			k := q.ID
+			if key == MergeByExportTag && q.dataExportTag != "" {
+				k = q.dataExportTag
+			}
+			mq, ok := byKey[k]
+			if !ok {
+				mq = &mergedQuestion{key: k, q: q, sources: make(map[int]*Question)}
+				byKey[k] = mq
+				order = append(order[:prev+1], append([]string{k}, order[prev+1:]...)...)
+			} else if _, ok := mq.sources[wi]; ok {
+				return nil, nil, fmt.Errorf("wave '%s' has more than one question matching '%s'", waves[wi].Name, k)
+			} else if mq.q.qType != q.qType {
+				return nil, nil, fmt.Errorf("question '%s' is a %s question in wave '%s' but a %s question in wave '%s'",
+					k, q.qType, waves[wi].Name, mq.q.qType, waves[latestWave(mq)].Name)
+			}
+			mq.sources[wi] = q
+			prev = indexOf(order, k)
+		}
+	}
+
+	last := waves[len(waves)-1].Survey
+	merged := &Survey{
+		ID:              last.ID,
+		Title:           last.Title,
+		Description:     last.Description,
+		Status:          last.Status,
+		Language:        last.Language,
+		CreatedOn:       waves[0].Survey.CreatedOn,
+		LaunchedOn:      waves[0].Survey.LaunchedOn,
+		ModifiedOn:      last.ModifiedOn,
+		Questions:       make(map[string]*Question),
+		NumericCodes:    last.NumericCodes,
+		IncludeMetadata: last.IncludeMetadata,
+		ExcludePII:      last.ExcludePII,
+		Naming:          last.Naming,
+		blocks:          make(map[string]*block),
+	}
+	waveQ := &Question{ID: WaveColumn, label: WaveColumn, qType: Embedded, dataType: CategoricalData}
+	for i, w := range waves {
+		waveQ.choices = append(waveQ.choices, Choice{ID: strconv.Itoa(i + 1), Label: w.Name})
+	}
+	merged.Questions[waveQ.ID] = waveQ
+	merged.QuestionOrder = append(merged.QuestionOrder, waveQ.ID)
+
+	report := &MergeReport{}
+	for _, w := range waves {
+		report.Waves = append(report.Waves, w.Name)
+	}
+	nextID := maxQuestionNumber(waves) + 1
+	firstIDs := make(map[string]string) // maps the IDs of the first wave's questions to their merged IDs
+	for _, k := range order {
+		mq := byKey[k]
+		mq.merge(len(waves))
+		if _, ok := merged.Questions[mq.q.ID]; ok {
+			mq.q.ID = fmt.Sprintf("QID%d", nextID)
+			nextID++
+		}
+		merged.Questions[mq.q.ID] = mq.q
+		merged.QuestionOrder = append(merged.QuestionOrder, mq.q.ID)
+		if q, ok := mq.sources[0]; ok {
+			firstIDs[q.ID] = mq.q.ID
+		}
+		if len(mq.sources) < len(waves) {
+			p := PartialQuestion{QuestionID: mq.q.ID, Key: k}
+			for wi, w := range waves {
+				if _, ok := mq.sources[wi]; ok {
+					p.Waves = append(p.Waves, w.Name)
+				}
+			}
+			report.Partial = append(report.Partial, p)
+		}
+	}
+
+	merged.copyStructure(waves[0].Survey, firstIDs)
+
+	scoring := make(map[string]int)
+	for _, w := range waves {
+		for _, c := range w.Survey.Scoring {
+			if i, ok := scoring[c.ID]; ok {
+				merged.Scoring[i] = c
+				continue
+			}
+			scoring[c.ID] = len(merged.Scoring)
+			merged.Scoring = append(merged.Scoring, c)
+		}
+	}
+
+	for wi, w := range waves {
+		keys := make(map[string]string)
+		values := make(map[string]map[string]string)
+		for _, k := range order {
+			mq := byKey[k]
+			if q, ok := mq.sources[wi]; ok {
+				for oldKey, newKey := range q.mergedAnswerKeys(mq.q) {
+					keys[oldKey] = newKey
+				}
+				for _, codedKey := range q.codedAnswerKeys() {
+					values[codedKey] = q.mergedValues(mq.q)
+				}
+			}
+		}
+		for _, c := range w.Survey.Scoring {
+			keys[c.ID] = c.ID
+		}
+		for _, r := range w.Survey.Responses {
+			nr := *r
+			nr.answers = map[string]string{WaveColumn: w.Name}
+			for oldKey, a := range r.answers {
+				newKey, ok := keys[oldKey]
+				if !ok {
+					continue
+				}
+				if v, ok := values[oldKey][a]; ok {
+					a = v
+				}
+				nr.answers[newKey] = a
+			}
+			merged.Responses = append(merged.Responses, &nr)
+		}
+	}
+	return merged, report, nil
+}
+
+// copyStructure gives s the blocks, block order, and QSF document of first, the first of the merged waves,
+// so that the merged survey keeps its survey flow and can be saved with WriteQsf. ids maps the IDs of first's questions
+// to their IDs in s. Questions that aren't in the first wave are added to the block of the question before them.
+func (s *Survey) copyStructure(first *Survey, ids map[string]string) {
+	s.blockOrder = append([]string{}, first.blockOrder...)
+	blockOf := make(map[string]*block) // keyed by question ID
+	for id, b := range first.blocks {
+		copied := &block{Type: b.Type, ID: b.ID, Description: b.Description}
+		for _, qid := range b.QuestionIDs {
+			if b.Type == "Trash" {
+				copied.QuestionIDs = append(copied.QuestionIDs, qid)
+				continue
+			}
+			if mergedID, ok := ids[qid]; ok {
+				copied.QuestionIDs = append(copied.QuestionIDs, mergedID)
+				blockOf[mergedID] = copied
+			}
+		}
+		s.blocks[id] = copied
+	}
+	prev := ""
+	for _, id := range s.QuestionOrder {
+		if s.Questions[id].qType == Embedded {
+			continue
+		}
+		if _, ok := blockOf[id]; !ok {
+			b := blockOf[prev]
+			for i := 0; b == nil && i < len(s.blockOrder); i++ {
+				b = s.blocks[s.blockOrder[i]]
+			}
+			if b == nil {
+				continue
+			}
+			i := indexOf(b.QuestionIDs, prev) + 1
+			b.QuestionIDs = append(b.QuestionIDs[:i:i], append([]string{id}, b.QuestionIDs[i:]...)...)
+			blockOf[id] = b
+		}
+		prev = id
+	}
+	if first.qsfDoc != nil {
+		s.qsfDoc = copyQsfValue(first.qsfDoc).(qsfObject)
+		s.original = first.original
+	}
+}
+
+// merge sets mq.q to a copy of the question from its most recent wave, with the choices, subquestions,
+// and groups of all of its waves
+func (mq *mergedQuestion) merge(nWaves int) {
+	latest := mq.sources[latestWave(mq)]
+	q := *latest
+	q.choices, q.subQuestions, q.groups = nil, nil, nil
+	for wi := nWaves - 1; wi >= 0; wi-- {
+		source, ok := mq.sources[wi]
+		if !ok {
+			continue
+		}
+		q.choices = mergeChoices(q.choices, source.choices)
+		q.subQuestions = mergeChoices(q.subQuestions, source.subQuestions)
+		for _, g := range source.groups {
+			if !contains(q.groups, g) {
+				q.groups = append(q.groups, g)
+			}
+		}
+	}
+	mq.q = &q
+}
+
+// latestWave returns the index of the most recent wave that includes mq
+func latestWave(mq *mergedQuestion) int {
+	latest := -1
+	for wi := range mq.sources {
+		if wi > latest {
+			latest = wi
+		}
+	}
+	return latest
+}
+
+// mergeChoices appends the choices that aren't already in merged, matching them by label.
+// Appended choices keep their IDs and variable names unless another choice already uses them.
+func mergeChoices(merged []Choice, choices []Choice) []Choice {
+	for _, c := range choices {
+		if findChoice(merged, c.Label) >= 0 {
+			continue
+		}
+		maxID := 0
+		for _, m := range merged {
+			if m.ID == c.ID {
+				c.ID = ""
+			}
+			if c.VarName != "" && m.VarName == c.VarName {
+				c.VarName = ""
+			}
+			if n, err := strconv.Atoi(m.ID); err == nil && n > maxID {
+				maxID = n
+			}
+		}
+		if c.ID == "" {
+			c.ID = strconv.Itoa(maxID + 1)
+		}
+		merged = append(merged, c)
+	}
+	return merged
+}
+
+// findChoice returns the index of the choice with the given label, or -1 if there isn't one
+func findChoice(choices []Choice, label string) int {
+	for i, c := range choices {
+		if c.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// mergedChoiceIDs maps the IDs of choices to the IDs of the choices with the same labels in merged
+func mergedChoiceIDs(choices []Choice, merged []Choice) map[string]string {
+	ids := make(map[string]string)
+	for _, c := range choices {
+		if i := findChoice(merged, c.Label); i >= 0 {
+			ids[c.ID] = merged[i].ID
+		}
+	}
+	return ids
+}
+
+// mergedAnswerKeys maps the keys of q's answers to the keys of the same answers to merged
+func (q *Question) mergedAnswerKeys(merged *Question) map[string]string {
+	keys := make(map[string]string)
+	choiceIDs := mergedChoiceIDs(q.choices, merged.choices)
+	switch q.qType {
+	case PickGroupRank:
+		for _, c := range q.choices {
+			for gi, g := range q.groups {
+				mgi := indexOf(merged.groups, g)
+				keys[fmt.Sprintf("%s_%d_GROUP_%s", q.ID, gi, c.ID)] = fmt.Sprintf("%s_%d_GROUP_%s", merged.ID, mgi, choiceIDs[c.ID])
+				keys[fmt.Sprintf("%s_G%d_%s_RANK", q.ID, gi, c.ID)] = fmt.Sprintf("%s_G%d_%s_RANK", merged.ID, mgi, choiceIDs[c.ID])
+			}
+			if c.HasText {
+				keys[q.ID+"_"+c.ID+"_TEXT"] = merged.ID + "_" + choiceIDs[c.ID] + "_TEXT"
+			}
+		}
+	case RankOrder:
+		// Map the keys of each choice's answers to those of the merged choice it was matched with,
+		// however each question keys its answers
+		oldKeys, newKeys := q.rankAnswerKeys(), merged.rankAnswerKeys()
+		for id, ks := range oldKeys {
+			for i, k := range ks {
+				if mergedKeys := newKeys[choiceIDs[id]]; i < len(mergedKeys) {
+					keys[k] = mergedKeys[i]
+				}
+			}
+		}
+	default:
+		renamed := *q
+		renamed.ID = merged.ID
+		renamed.choices = renameChoices(q.choices, choiceIDs)
+		renamed.subQuestions = renameChoices(q.subQuestions, mergedChoiceIDs(q.subQuestions, merged.subQuestions))
+		newSuffixes := renamed.qType.internalSuffixes(&renamed)
+		for i, s := range q.qType.internalSuffixes(q) {
+			keys[q.ID+s] = renamed.ID + newSuffixes[i]
+		}
+	}
+	return keys
+}
+
+// rankAnswerKeys returns the keys of the rank, and text if it has one, of each choice of q, a rank order question,
+// keyed by choice ID
+func (q *Question) rankAnswerKeys() map[string][]string {
+	keys := make(map[string][]string)
+	suffixes := q.qType.internalSuffixes(q)
+	i := 0
+	for _, c := range q.choices {
+		n := 1
+		if c.HasText {
+			n = 2
+		}
+		for _, s := range suffixes[i : i+n] {
+			keys[c.ID] = append(keys[c.ID], q.ID+s)
+		}
+		i += n
+	}
+	return keys
+}
+
+// renameChoices returns a copy of choices using the IDs in ids
+func renameChoices(choices []Choice, ids map[string]string) []Choice {
+	renamed := make([]Choice, len(choices))
+	for i, c := range choices {
+		renamed[i] = c
+		renamed[i].ID = ids[c.ID]
+	}
+	return renamed
+}
+
+// mergedValues maps the label and variable name of each of q's choices to the text of the matching choice in merged
+func (q *Question) mergedValues(merged *Question) map[string]string {
+	values := make(map[string]string)
+	for _, c := range q.choices {
+		if i := findChoice(merged.choices, c.Label); i >= 0 {
+			values[c.Label] = merged.choices[i].choiceText()
+			if c.VarName != "" {
+				values[c.VarName] = merged.choices[i].choiceText()
+			}
+		}
+	}
+	return values
+}
+
+// maxQuestionNumber returns the highest n of any question named QIDn in waves
+func maxQuestionNumber(waves []Wave) int {
+	max := 0
+	for _, w := range waves {
+		for id := range w.Survey.Questions {
+			if m := reQID.FindStringSubmatch(id); m != nil {
+				if n, err := strconv.Atoi(m[1]); err == nil && n > max {
+					max = n
+				}
+			}
+		}
+	}
+	return max
+}
+
+func indexOf(ids []string, id string) int {
+	for i, s := range ids {
+		if s == id {
+			return i
+		}
+	}
+	return -1
+}
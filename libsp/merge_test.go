@@ -0,0 +1,247 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func readWave(name string) (Wave, error) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		return Wave{}, err
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		return Wave{}, err
+	}
+	return Wave{Name: name, Survey: s}, nil
+}
+
+func TestMergeWaves(t *testing.T) {
+	first, err := readWave("first")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second, err := readWave("second")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second.Survey.Questions["QID1"].choices[0].Label = "Yes"
+	second.Survey.Questions["QID4"].SetExportTag("Q4_new")
+	second.Survey.QuestionOrder = removeID(second.Survey.QuestionOrder, "QID3")
+	delete(second.Survey.Questions, "QID3")
+
+	tests := []struct {
+		key         MergeKey
+		nQuestions  int
+		partialKeys []string
+	}{
+		{MergeByID, len(first.Survey.QuestionOrder) + 1, []string{"QID3"}},
+		{MergeByExportTag, len(first.Survey.QuestionOrder) + 2, []string{"Q3", "Q4", "Q4_new"}},
+	}
+	for _, test := range tests {
+		s, report, err := MergeWaves([]Wave{first, second}, test.key)
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		if len(s.QuestionOrder) != test.nQuestions {
+			t.Errorf("len(QuestionOrder) = %d; want %d", len(s.QuestionOrder), test.nQuestions)
+		}
+		if len(s.Responses) != len(first.Survey.Responses)+len(second.Survey.Responses) {
+			t.Errorf("len(Responses) = %d; want %d", len(s.Responses), len(first.Survey.Responses)+len(second.Survey.Responses))
+		}
+		partialKeys := []string{}
+		for _, p := range report.Partial {
+			partialKeys = append(partialKeys, p.Key)
+		}
+		if !equalStrings(partialKeys, test.partialKeys) {
+			t.Errorf("Partial keys = %v; want %v", partialKeys, test.partialKeys)
+		}
+	}
+
+	s, report, err := MergeWaves([]Wave{first, second}, MergeByID)
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if len(report.Partial) != 1 || !equalStrings(report.Partial[0].Waves, []string{"first"}) {
+		t.Errorf("Partial = %v; want QID3 in wave first", report.Partial)
+	}
+	labels := []string{}
+	for _, c := range s.Questions["QID1"].choices {
+		labels = append(labels, c.Label)
+	}
+	wantLabels := []string{"Yes", "Click to write Choice 2", "Click to write Choice 3", "Click to write Choice 1"}
+	if !equalStrings(labels, wantLabels) {
+		t.Errorf("QID1 choices = %v; want %v", labels, wantLabels)
+	}
+
+	cols := s.csvCols()
+	col := func(name string) int {
+		return indexOf(cols, name)
+	}
+	if col(WaveColumn) < 0 || col("Q1Label") < 0 || col("Q3Label") < 0 {
+		t.Errorf("csvCols() = %v; want wave, Q1Label, and Q3Label columns", cols)
+		return
+	}
+	tests2 := []struct {
+		row  int
+		col  string
+		want string
+	}{
+		{0, WaveColumn, "first"},
+		{0, "Q1Label", "Click to write Choice 1"},
+		{0, "Q3Label", "Click to write Choice 2"},
+		{len(first.Survey.Responses), WaveColumn, "second"},
+		{len(first.Survey.Responses), "Q3Label", ""},
+	}
+	for _, test := range tests2 {
+		row := s.csvRow(s.Responses[test.row])
+		if got := row[col(test.col)]; got != test.want {
+			t.Errorf("row %d, %s = '%s'; want '%s'", test.row, test.col, got, test.want)
+		}
+	}
+}
+
+func TestMergeWavesStructure(t *testing.T) {
+	first, err := readWave("first")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second, err := readWave("second")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// Matched by export tag, QID4 is a new question in the second wave
+	second.Survey.Questions["QID4"].SetExportTag("Q4_new")
+	firstDoc, _ := json.Marshal(first.Survey.qsfDoc)
+
+	s, _, err := MergeWaves([]Wave{first, second}, MergeByExportTag)
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if !equalStrings(s.BlockOrder(), first.Survey.BlockOrder()) {
+		t.Errorf("BlockOrder() = %v; want %v", s.BlockOrder(), first.Survey.BlockOrder())
+	}
+	newID := s.QuestionOrder[indexOf(s.QuestionOrder, "QID4")+1]
+	if s.Questions[newID].ExportTag() != "Q4_new" {
+		t.Errorf("question after QID4 = %s (%s); want the new Q4_new question", newID, s.Questions[newID].ExportTag())
+	}
+	blockOf := make(map[string]string)
+	for _, id := range s.BlockOrder() {
+		for _, qid := range s.blocks[id].QuestionIDs {
+			if other, ok := blockOf[qid]; ok {
+				t.Errorf("%s is in blocks %s and %s", qid, other, id)
+			}
+			blockOf[qid] = id
+		}
+	}
+	for _, id := range s.QuestionOrder {
+		if _, ok := blockOf[id]; !ok && s.Questions[id].qType != Embedded {
+			t.Errorf("%s isn't in any block", id)
+		}
+	}
+	if blockOf[newID] != blockOf["QID4"] {
+		t.Errorf("%s is in block %s; want %s, with the question before it", newID, blockOf[newID], blockOf["QID4"])
+	}
+
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if s2.Questions[WaveColumn] == nil || s2.Questions[newID] == nil {
+		t.Errorf("WriteQsf() output is missing the %s field or question %s", WaveColumn, newID)
+	}
+	if len(s2.QuestionOrder) != len(s.QuestionOrder) {
+		t.Errorf("len(QuestionOrder) after WriteQsf = %d; want %d", len(s2.QuestionOrder), len(s.QuestionOrder))
+	}
+	if doc, _ := json.Marshal(first.Survey.qsfDoc); !bytes.Equal(doc, firstDoc) {
+		t.Errorf("writing the merged survey changed the first wave's QSF document")
+	}
+}
+
+func TestMergeWavesRankOrder(t *testing.T) {
+	first, err := readWave("first")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second, err := readWave("second")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// The second wave shows the items in reverse order, so each rank is stored under a different key
+	// (the merged question lists them in the second wave's order)
+	var want []map[string]string
+	for _, w := range []Wave{first, second} {
+		for _, r := range w.Survey.Responses {
+			want = append(want, map[string]string{"QID10_3": r.answers["QID10_1"], "QID10_1": r.answers["QID10_3"]})
+		}
+	}
+	q := second.Survey.Questions["QID10"]
+	q.choices = []Choice{q.choices[2], q.choices[1], q.choices[0]}
+	for _, r := range second.Survey.Responses {
+		r.answers["QID10_1"], r.answers["QID10_3"] = r.answers["QID10_3"], r.answers["QID10_1"]
+	}
+
+	s, _, err := MergeWaves([]Wave{first, second}, MergeByID)
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if len(s.Responses) != len(want) {
+		t.Errorf("len(Responses) = %d; want %d", len(s.Responses), len(want))
+		return
+	}
+	for i, r := range s.Responses {
+		for k, v := range want[i] {
+			if r.answers[k] != v {
+				t.Errorf("response %d: %s = '%s'; want '%s'", i, k, r.answers[k], v)
+			}
+		}
+	}
+}
+
+func TestMergeWavesErrors(t *testing.T) {
+	first, err := readWave("first")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second, err := readWave("second")
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	second.Survey.Questions["QID1"].qType = MultipleChoiceMultiResponse
+
+	tests := []struct {
+		waves []Wave
+		want  string
+	}{
+		{[]Wave{}, "no waves to merge"},
+		{[]Wave{first, {Name: "first", Survey: first.Survey}}, "waves need unique names, found 'first'"},
+		{[]Wave{first, second}, "question 'QID1' is a MultipleChoiceSingleResponse question in wave 'first' but a MultipleChoiceMultiResponse question in wave 'second'"},
+	}
+	for _, test := range tests {
+		_, _, err := MergeWaves(test.waves, MergeByID)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("MergeWaves() err = %v; want '%s'", err, test.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package libsp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NamingStrategy chooses the CSV column names of survey questions. Set Survey.Naming to use one;
+// the chosen names are used by every output format, script, and codebook.
+type NamingStrategy interface {
+	// ColumnName returns the name of one of q's columns. suffix identifies the column within q
+	// (e.g., "_statement1" or "_text"); it is empty for questions with a single column.
+	ColumnName(q *Question, suffix string) string
+}
+
+// DefaultNaming names columns after the question's label if its author set one, otherwise its export tag or ID
+type DefaultNaming struct{}
+
+// ColumnName implements NamingStrategy
+func (DefaultNaming) ColumnName(q *Question, suffix string) string {
+	return q.csvPrefix() + suffix
+}
+
+// QIDNaming names columns after the question's ID, e.g. QID4_1
+type QIDNaming struct{}
+
+// ColumnName implements NamingStrategy
+func (QIDNaming) ColumnName(q *Question, suffix string) string {
+	return q.ID + suffix
+}
+
+// ExportTagNaming names columns after the question's export tag, or its ID if it has no export tag
+type ExportTagNaming struct{}
+
+// ColumnName implements NamingStrategy
+func (ExportTagNaming) ColumnName(q *Question, suffix string) string {
+	if q.dataExportTag != "" {
+		return q.dataExportTag + suffix
+	}
+	return q.ID + suffix
+}
+
+// maxSlugLength is the longest slug LabelSlugNaming makes from a question's label or wording
+const maxSlugLength = 30
+
+var reHTMLTags = regexp.MustCompile(`<[^>]*>`)
+var reNonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// LabelSlugNaming names columns after a lowercase slug of the question's label, or its wording if it has no label,
+// e.g. how_old_are_you
+type LabelSlugNaming struct{}
+
+// ColumnName implements NamingStrategy
+func (LabelSlugNaming) ColumnName(q *Question, suffix string) string {
+	text := q.label
+	if text == "" {
+		text = q.Wording
+	}
+	slug := reNonSlugChars.ReplaceAllString(strings.ToLower(reHTMLTags.ReplaceAllString(text, " ")), "_")
+	slug = strings.Trim(slug, "_")
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+		if i := strings.LastIndex(slug, "_"); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	if slug == "" {
+		return ExportTagNaming{}.ColumnName(q, suffix)
+	}
+	return slug + suffix
+}
+
+var reCamelCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+var reNonSnakeChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// SnakeCaseNaming converts the names chosen by DefaultNaming to snake case, e.g. Q5Label_statement1 becomes q5_label_statement1
+type SnakeCaseNaming struct{}
+
+// ColumnName implements NamingStrategy
+func (SnakeCaseNaming) ColumnName(q *Question, suffix string) string {
+	name := reCamelCase.ReplaceAllString(DefaultNaming{}.ColumnName(q, suffix), "${1}_${2}")
+	name = reNonSnakeChars.ReplaceAllString(name, "_")
+	return strings.ToLower(strings.Trim(name, "_"))
+}
+
+// MaxLength limits the names chosen by Base to N characters, e.g. for Stata (32) or SPSS (64).
+// Long names are shortened before their suffix, so columns of the same question stay recognizable.
+// The limit also applies to names set by Overrides and to the names that make colliding columns unique.
+type MaxLength struct {
+	N    int
+	Base NamingStrategy
+}
+
+// ColumnName implements NamingStrategy. It returns Base's name in full; Survey shortens it along with the survey's other names.
+func (m MaxLength) ColumnName(q *Question, suffix string) string {
+	return m.Base.ColumnName(q, suffix)
+}
+
+// shortenName shortens name, which usually ends with suffix, to max characters by removing characters before suffix.
+// If name doesn't end with suffix, or suffix doesn't fit, name is cut at max characters. max <= 0 means no limit.
+func shortenName(name, suffix string, max int) string {
+	if max <= 0 || len(name) <= max {
+		return name
+	}
+	if strings.HasSuffix(name, suffix) && len(suffix) < max {
+		return name[:max-len(suffix)] + suffix
+	}
+	return name[:max]
+}
+
+// ParseNamingStrategy returns the NamingStrategy named by s: default, qid, export_tag, label_slug, or snake_case,
+// optionally combined with a length limit, e.g. "export_tag,max_length:32". "max_length:N" on its own limits the default names.
+func ParseNamingStrategy(s string) (NamingStrategy, error) {
+	var base NamingStrategy
+	maxLength := 0
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "max_length:") {
+			n, err := strconv.Atoi(strings.TrimPrefix(part, "max_length:"))
+			if err != nil || n < 8 {
+				return nil, fmt.Errorf("invalid length in '%s': must be a number of at least 8", part)
+			}
+			maxLength = n
+			continue
+		}
+		if base != nil {
+			return nil, fmt.Errorf("more than one naming strategy in '%s'", s)
+		}
+		switch part {
+		case "default":
+			base = DefaultNaming{}
+		case "qid":
+			base = QIDNaming{}
+		case "export_tag":
+			base = ExportTagNaming{}
+		case "label_slug":
+			base = LabelSlugNaming{}
+		case "snake_case":
+			base = SnakeCaseNaming{}
+		default:
+			return nil, fmt.Errorf("unknown naming strategy '%s'", part)
+		}
+	}
+	if base == nil {
+		base = DefaultNaming{}
+	}
+	if maxLength > 0 {
+		return MaxLength{N: maxLength, Base: base}, nil
+	}
+	return base, nil
+}
+
+// naming returns the survey's NamingStrategy
+func (s *Survey) naming() NamingStrategy {
+	if s.Naming == nil {
+		return DefaultNaming{}
+	}
+	return s.Naming
+}
+
+// maxNameLength returns the length limit of the survey's column names, or 0 if there isn't one
+func (s *Survey) maxNameLength() int {
+	if m, ok := s.naming().(MaxLength); ok {
+		return m.N
+	}
+	return 0
+}
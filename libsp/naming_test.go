@@ -0,0 +1,105 @@
+package libsp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestNamingStrategies(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.Questions["QID7"].Wording = "<b>How old</b> are you?"
+	s.Questions["QID7"].label = ""
+	// Qualtrics copied QID20's text into its label, so its columns are named after its export tag
+	s.Questions["QID20"].Wording = "Question text for <i>dynamic</i> choices."
+	// An author-chosen label is used however long it is
+	s.Questions["QID8"].label = "ReasonsForChoosingThisProductOverOthers"
+
+	tests := []struct {
+		naming NamingStrategy
+		id     string
+		want   []string
+	}{
+		{nil, "QID5", []string{"Q5Label_statement1", "Q5Label_statement2", "Q5Label_statement3", "Q5Label_other", "Q5Label_other_text"}},
+		{DefaultNaming{}, "QID20", []string{"Q20"}},
+		{DefaultNaming{}, "QID8", []string{"ReasonsForChoosingThisProductOverOthers_text"}},
+		{DefaultNaming{}, "QID16", []string{"Q16_first_click", "Q16_last_click", "Q16_page_submit", "Q16_click_count"}},
+		{QIDNaming{}, "QID5", []string{"QID5_statement1", "QID5_statement2", "QID5_statement3", "QID5_other", "QID5_other_text"}},
+		{QIDNaming{}, "s", []string{"s"}},
+		{ExportTagNaming{}, "QID1", []string{"Q1"}},
+		{ExportTagNaming{}, "QID17", []string{"Q17_item.1_GROUP", "Q17_item.1_RANK", "Q17_item.2_GROUP", "Q17_item.2_RANK", "Q17_item.3_GROUP", "Q17_item.3_RANK", "Q17_item.4_GROUP", "Q17_item.4_RANK", "Q17_other_GROUP", "Q17_other_RANK", "Q17_other_text"}},
+		{LabelSlugNaming{}, "QID1", []string{"q1label"}},
+		{LabelSlugNaming{}, "QID7", []string{"how_old_are_you_text"}},
+		{SnakeCaseNaming{}, "QID5", []string{"q5_label_statement1", "q5_label_statement2", "q5_label_statement3", "q5_label_other", "q5_label_other_text"}},
+		{SnakeCaseNaming{}, "QID17", []string{"pgr_item_1_group", "pgr_item_1_rank", "pgr_item_2_group", "pgr_item_2_rank", "pgr_item_3_group", "pgr_item_3_rank", "pgr_item_4_group", "pgr_item_4_rank", "pgr_other_group", "pgr_other_rank", "pgr_other_text"}},
+		{MaxLength{N: 12, Base: DefaultNaming{}}, "QID5", []string{"Q_statement1", "Q_statement2", "Q_statement3", "Q5Labe_other", "Q_other_text"}},
+	}
+	for _, test := range tests {
+		s.Naming = test.naming
+		if got := s.ColumnNames()[test.id]; !equalStrings(got, test.want) {
+			t.Errorf("%T: ColumnNames()[%s] = %v; want %v", test.naming, test.id, got, test.want)
+		}
+	}
+}
+
+func TestParseNamingStrategy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want NamingStrategy
+		err  string
+	}{
+		{"default", DefaultNaming{}, ""},
+		{"qid", QIDNaming{}, ""},
+		{"export_tag", ExportTagNaming{}, ""},
+		{"label_slug", LabelSlugNaming{}, ""},
+		{"snake_case", SnakeCaseNaming{}, ""},
+		{"max_length:32", MaxLength{N: 32, Base: DefaultNaming{}}, ""},
+		{"snake_case, max_length:64", MaxLength{N: 64, Base: SnakeCaseNaming{}}, ""},
+		{"camel_case", nil, "unknown naming strategy 'camel_case'"},
+		{"qid,export_tag", nil, "more than one naming strategy in 'qid,export_tag'"},
+		{"max_length:x", nil, "invalid length in 'max_length:x': must be a number of at least 8"},
+	}
+	for _, test := range tests {
+		got, err := ParseNamingStrategy(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ParseNamingStrategy(%q) err = %v; want '%s'", test.s, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseNamingStrategy(%q) err = %s", test.s, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseNamingStrategy(%q) = %#v; want %#v", test.s, got, test.want)
+		}
+	}
+}
+
+func TestMaxLengthCollisions(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// Many columns shorten to the same name (e.g., QID19_choice1 and QID19_choice2 both become QID19_ch);
+	// the names that make them unique must also fit the limit
+	s.Naming = MaxLength{N: 8, Base: QIDNaming{}}
+	seen := make(map[string]bool)
+	for _, cols := range s.ColumnNames() {
+		for _, col := range cols {
+			if len(col) > 8 {
+				t.Errorf("column '%s' is longer than 8 characters", col)
+			}
+			if seen[col] {
+				t.Errorf("column '%s' is used more than once", col)
+			}
+			seen[col] = true
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package libsp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides holds a study's adjustments to sp's output, usually read from an sp.yaml or sp.json file next to the QSF.
+// Questions are referred to by ID or export tag, and columns by their CSV column name.
+type Overrides struct {
+	Rename     map[string]string   `json:"rename,omitempty" yaml:"rename"`           // new column names, keyed by column
+	Drop       []string            `json:"drop,omitempty" yaml:"drop"`               // questions to leave out of the output
+	Types      map[string]string   `json:"types,omitempty" yaml:"types"`             // column types, keyed by column or question (for all of its columns)
+	Levels     map[string][]string `json:"levels,omitempty" yaml:"levels"`           // factor level order, keyed by question; unlisted levels keep their order after the listed ones
+	Ordered    map[string]bool     `json:"ordered,omitempty" yaml:"ordered"`         // whether a question's factor levels are ordered
+	MergeOther []string            `json:"merge_other,omitempty" yaml:"merge_other"` // single-response questions whose "Other" text replaces the choice's label
+}
+
+// overrideTypes maps the column types allowed in Overrides.Types to their R column types
+var overrideTypes = map[string]string{
+	"character": "col_character()",
+	"double":    "col_double()",
+	"integer":   "col_integer()",
+	"logical":   "col_logical()",
+	"factor":    "col_factor()",
+	"date":      "col_date()",
+	"datetime":  "col_datetime()",
+}
+
+// ReadOverrides parses overrides in YAML or JSON format (JSON being a subset of YAML); unknown settings are an error
+func ReadOverrides(r *bufio.Reader) (*Overrides, error) {
+	if r == nil {
+		return nil, errors.New("r cannot be nil")
+	}
+	o := &Overrides{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(o); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("could not parse overrides: %s", err)
+	}
+	return o, nil
+}
+
+// Validate describes each override that can't be applied to s, e.g. because it refers to a question or column s doesn't have.
+// ApplyOverrides skips these overrides.
+func (o *Overrides) Validate(s *Survey) []string {
+	problems := []string{}
+	names := s.columnNames()
+	for _, col := range sortedKeys(o.Rename) {
+		if q, _ := s.findColumn(col, names); q == nil {
+			problems = append(problems, fmt.Sprintf("rename: no column named '%s'", col))
+		} else if o.Rename[col] == "" {
+			problems = append(problems, fmt.Sprintf("rename: new name for column '%s' is empty", col))
+		}
+	}
+	for _, key := range o.Drop {
+		if s.findQuestion(key) == nil {
+			problems = append(problems, fmt.Sprintf("drop: no question with ID or export tag '%s'", key))
+		}
+	}
+	for _, key := range sortedKeys(o.Types) {
+		if _, ok := overrideTypes[o.Types[key]]; !ok {
+			problems = append(problems, fmt.Sprintf("types: unknown type '%s' for '%s' (use character, double, integer, logical, factor, date, or datetime)", o.Types[key], key))
+		} else if len(s.overrideColumns(key, names)) == 0 {
+			problems = append(problems, fmt.Sprintf("types: no column or question named '%s'", key))
+		}
+	}
+	for _, key := range sortedKeys(o.Levels) {
+		q := s.findQuestion(key)
+		if q == nil {
+			problems = append(problems, fmt.Sprintf("levels: no question with ID or export tag '%s'", key))
+			continue
+		}
+		levels, ok := q.levelLabels()
+		if !ok {
+			problems = append(problems, fmt.Sprintf("levels: %s has no factor levels to reorder", q.ID))
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, l := range o.Levels[key] {
+			if !contains(levels, l) {
+				problems = append(problems, fmt.Sprintf("levels: %s has no level '%s'", q.ID, l))
+			} else if seen[l] {
+				problems = append(problems, fmt.Sprintf("levels: level '%s' of %s is listed more than once", l, q.ID))
+			}
+			seen[l] = true
+		}
+	}
+	for _, key := range sortedKeys(o.Ordered) {
+		q := s.findQuestion(key)
+		if q == nil {
+			problems = append(problems, fmt.Sprintf("ordered: no question with ID or export tag '%s'", key))
+		} else if _, ok := q.levelLabels(); !ok {
+			problems = append(problems, fmt.Sprintf("ordered: %s has no factor levels", q.ID))
+		}
+	}
+	for _, key := range o.MergeOther {
+		q := s.findQuestion(key)
+		if q == nil {
+			problems = append(problems, fmt.Sprintf("merge_other: no question with ID or export tag '%s'", key))
+		} else if !q.canMergeOther() {
+			problems = append(problems, fmt.Sprintf("merge_other: %s is not a single-response multiple choice question with a text entry choice", q.ID))
+		}
+	}
+	return problems
+}
+
+// ApplyOverrides changes s as described by o, skipping any overrides reported by o.Validate(s).
+// Columns are matched using the names chosen by s.Naming, so set it first.
+func (s *Survey) ApplyOverrides(o *Overrides) {
+	if o == nil {
+		return
+	}
+	// Resolve column names before changing any questions, since that can change the names
+	names := s.columnNames()
+	for _, col := range sortedKeys(o.Rename) {
+		if q, colID := s.findColumn(col, names); q != nil && o.Rename[col] != "" {
+			if q.colNames == nil {
+				q.colNames = make(map[string]string)
+			}
+			q.colNames[colID] = o.Rename[col]
+		}
+	}
+	// Apply types set for whole questions first, so a type set for one of a question's columns takes precedence
+	questionKeys, columnKeys := []string{}, []string{}
+	for _, key := range sortedKeys(o.Types) {
+		if q, _ := s.findColumn(key, names); q != nil {
+			columnKeys = append(columnKeys, key)
+		} else {
+			questionKeys = append(questionKeys, key)
+		}
+	}
+	for _, key := range append(questionKeys, columnKeys...) {
+		rColType, ok := overrideTypes[o.Types[key]]
+		if !ok {
+			continue
+		}
+		for _, col := range s.overrideColumns(key, names) {
+			col.q.setColType(col.id, rColType)
+		}
+	}
+
+	for _, key := range sortedKeys(o.Levels) {
+		if q := s.findQuestion(key); q != nil {
+			q.reorderLevels(o.Levels[key])
+		}
+	}
+	for _, key := range sortedKeys(o.Ordered) {
+		if q := s.findQuestion(key); q != nil {
+			if _, ok := q.levelLabels(); ok {
+				q.orderedChoices = o.Ordered[key]
+			}
+		}
+	}
+	for _, key := range o.MergeOther {
+		if q := s.findQuestion(key); q != nil && q.canMergeOther() {
+			q.mergeOther(s.Responses)
+		}
+	}
+	for _, key := range o.Drop {
+		if q := s.findQuestion(key); q != nil {
+			s.dropQuestion(q.ID)
+		}
+	}
+}
+
+// dropQuestion removes the question with the given ID from the survey, including its block
+func (s *Survey) dropQuestion(id string) {
+	i := indexOf(s.QuestionOrder, id)
+	s.QuestionOrder = append(s.QuestionOrder[:i], s.QuestionOrder[i+1:]...)
+	for _, b := range s.blocks {
+		if j := indexOf(b.QuestionIDs, id); j >= 0 {
+			// Copy the IDs, since the survey's original snapshot may share them
+			ids := append([]string{}, b.QuestionIDs[:j]...)
+			b.QuestionIDs = append(ids, b.QuestionIDs[j+1:]...)
+		}
+	}
+	delete(s.Questions, id)
+}
+
+// findQuestion returns the question with the given ID or export tag, or nil if there isn't one
+func (s *Survey) findQuestion(key string) *Question {
+	if contains(s.QuestionOrder, key) {
+		return s.Questions[key]
+	}
+	for _, id := range s.QuestionOrder {
+		if q := s.Questions[id]; q.dataExportTag == key {
+			return q
+		}
+	}
+	return nil
+}
+
+// findColumn returns the question writing the column named name, and the column's ID in the question's CSVCols(),
+// or nil if no question writes that column
+func (s *Survey) findColumn(name string, names *columnNames) (*Question, string) {
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		for i, col := range names.questions[id] {
+			if col == name {
+				return q, q.CSVCols()[i]
+			}
+		}
+	}
+	return nil, ""
+}
+
+// overrideColumn identifies one of a question's columns by its ID in Question.CSVCols()
+type overrideColumn struct {
+	q  *Question
+	id string
+}
+
+// overrideColumns returns the column named key, or if there isn't one, every column of the question with ID or export tag key
+func (s *Survey) overrideColumns(key string, names *columnNames) []overrideColumn {
+	if q, colID := s.findColumn(key, names); q != nil {
+		return []overrideColumn{{q, colID}}
+	}
+	cols := []overrideColumn{}
+	if q := s.findQuestion(key); q != nil {
+		for _, colID := range q.CSVCols() {
+			cols = append(cols, overrideColumn{q, colID})
+		}
+	}
+	return cols
+}
+
+func (q *Question) setColType(colID, rColType string) {
+	if q.colTypes == nil {
+		q.colTypes = make(map[string]string)
+	}
+	q.colTypes[colID] = rColType
+}
+
+// levelLabels returns the labels that make up q's factor levels, and false if q has no factor columns with levels to reorder
+func (q *Question) levelLabels() ([]string, bool) {
+	if q.qType == PickGroupRank {
+		return q.groups, len(q.groups) > 0
+	}
+	if q.RColType() != "col_factor()" || q.qType == RankOrder || len(q.choices) == 0 {
+		return nil, false
+	}
+	labels := []string{}
+	for _, c := range q.choices {
+		labels = append(labels, c.Label)
+	}
+	return labels, true
+}
+
+// reorderLevels moves the given factor levels to the front of q's levels, in the given order
+func (q *Question) reorderLevels(first []string) {
+	if q.qType == PickGroupRank {
+		q.groups = reorderLabels(q.groups, first)
+		return
+	}
+	labels, ok := q.levelLabels()
+	if !ok {
+		return
+	}
+	choices := make([]Choice, 0, len(q.choices))
+	for _, l := range reorderLabels(labels, first) {
+		choices = append(choices, q.choices[indexOf(labels, l)])
+	}
+	q.choices = choices
+}
+
+// reorderLabels returns labels with those in first moved to the front, in the order they appear in first
+func reorderLabels(labels []string, first []string) []string {
+	reordered := []string{}
+	for _, l := range first {
+		if contains(labels, l) && !contains(reordered, l) {
+			reordered = append(reordered, l)
+		}
+	}
+	for _, l := range labels {
+		if !contains(reordered, l) {
+			reordered = append(reordered, l)
+		}
+	}
+	return reordered
+}
+
+// canMergeOther returns true if q is a single-response question with at least one text entry choice
+func (q *Question) canMergeOther() bool {
+	if q.qType != MultipleChoiceSingleResponse {
+		return false
+	}
+	for _, c := range q.choices {
+		if c.HasText {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeOther replaces the answers of respondents who chose one of q's text entry choices with the text they entered,
+// removing the text entry columns. Since its values no longer match q's choices, q's answer column becomes a character column.
+func (q *Question) mergeOther(responses []*Response) {
+	col := q.CSVCols()[0]
+	for i, c := range q.choices {
+		if !c.HasText {
+			continue
+		}
+		key := q.ID + "_" + c.ID + "_TEXT"
+		for _, r := range responses {
+			text := strings.TrimSpace(r.answers[key])
+			if text != "" && !isNoResponseCode(text) && q.isAnswer(r.answers[q.ID], c) {
+				r.answers[q.ID] = text
+			}
+			delete(r.answers, key)
+		}
+		q.choices[i].HasText = false
+	}
+	q.setColType(col, "col_character()")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
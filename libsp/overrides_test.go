@@ -0,0 +1,253 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const overridesTestContent = `
+rename:
+  Q1Label: satisfaction
+  Q99Label: missing
+drop: [Q3, QID99]
+types:
+  Q7Label_text: double
+  Q16: integer
+  Q8Label_text: number
+levels:
+  Q18: ["Click to write Choice 1 (ordered 3rd)"]
+  QID17: [Group 3, Group 1]
+  Q7: [a]
+ordered:
+  QID1: true
+merge_other: [Q11, Q4]
+`
+
+func readOverridesTestSurvey(t *testing.T) *Survey {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	return s
+}
+
+func TestReadOverrides(t *testing.T) {
+	tests := []struct {
+		content string
+		want    *Overrides
+		err     string
+	}{
+		{overridesTestContent, &Overrides{Rename: map[string]string{"Q1Label": "satisfaction", "Q99Label": "missing"}, Drop: []string{"Q3", "QID99"}, MergeOther: []string{"Q11", "Q4"}}, ""},
+		{`{"rename": {"Q1Label": "satisfaction"}, "merge_other": ["Q11"]}`, &Overrides{Rename: map[string]string{"Q1Label": "satisfaction"}, MergeOther: []string{"Q11"}}, ""},
+		{"", &Overrides{}, ""},
+		{"renames:\n  Q1Label: satisfaction\n", nil, "could not parse overrides: yaml: unmarshal errors:\n  line 1: field renames not found in type libsp.Overrides"},
+	}
+	for _, test := range tests {
+		got, err := ReadOverrides(bufio.NewReader(strings.NewReader(test.content)))
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ReadOverrides(%q) err = %v; want '%s'", test.content, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReadOverrides(%q) err = %s", test.content, err)
+			continue
+		}
+		if len(got.Rename) != len(test.want.Rename) || got.Rename["Q1Label"] != test.want.Rename["Q1Label"] {
+			t.Errorf("ReadOverrides(%q).Rename = %v; want %v", test.content, got.Rename, test.want.Rename)
+		}
+		if !equalStrings(got.Drop, test.want.Drop) {
+			t.Errorf("ReadOverrides(%q).Drop = %v; want %v", test.content, got.Drop, test.want.Drop)
+		}
+		if !equalStrings(got.MergeOther, test.want.MergeOther) {
+			t.Errorf("ReadOverrides(%q).MergeOther = %v; want %v", test.content, got.MergeOther, test.want.MergeOther)
+		}
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	s := readOverridesTestSurvey(t)
+	if s == nil {
+		return
+	}
+	o, err := ReadOverrides(bufio.NewReader(strings.NewReader(overridesTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	want := []string{
+		"rename: no column named 'Q99Label'",
+		"drop: no question with ID or export tag 'QID99'",
+		"types: unknown type 'number' for 'Q8Label_text' (use character, double, integer, logical, factor, date, or datetime)",
+		"levels: QID7 has no factor levels to reorder",
+		"merge_other: QID4 is not a single-response multiple choice question with a text entry choice",
+	}
+	if got := o.Validate(s); !equalStrings(got, want) {
+		t.Errorf("Validate() = %q; want %q", got, want)
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	s := readOverridesTestSurvey(t)
+	if s == nil {
+		return
+	}
+	o, err := ReadOverrides(bufio.NewReader(strings.NewReader(overridesTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.ApplyOverrides(o)
+
+	if _, ok := s.Questions["QID3"]; ok || contains(s.QuestionOrder, "QID3") {
+		t.Errorf("QID3 was not dropped")
+	}
+	names := s.ColumnNames()
+	if got := names["QID1"]; !equalStrings(got, []string{"satisfaction"}) {
+		t.Errorf("ColumnNames()[QID1] = %v; want [satisfaction]", got)
+	}
+	if got := names["QID11"]; !equalStrings(got, []string{"Q11Label"}) {
+		t.Errorf("ColumnNames()[QID11] = %v; want [Q11Label]", got)
+	}
+
+	cols := s.csvCols()
+	types := s.csvColTypes()
+	wantTypes := map[string]string{
+		"satisfaction":    "col_factor()",
+		"Q7Label_text":    "col_double()",
+		"Q8Label_text":    "col_character()",
+		"Q16_first_click": "col_integer()",
+		"Q16_click_count": "col_integer()",
+		"Q11Label":        "col_character()",
+	}
+	for i, col := range cols {
+		if want, ok := wantTypes[col]; ok && types[i] != want {
+			t.Errorf("type of %s = %s; want %s", col, types[i], want)
+		}
+	}
+
+	q11 := indexOf(cols, "Q11Label")
+	wantQ11 := []string{"Click to write Choice 2 (ordered 1st)", "other text", "", "other text"}
+	for i, r := range s.Responses {
+		if got := s.csvRow(r)[q11]; got != wantQ11[i] {
+			t.Errorf("response %d: Q11Label = %q; want %q", i, got, wantQ11[i])
+		}
+	}
+
+	if got, _ := s.Questions["QID18"].levelLabels(); !equalStrings(got, []string{"Click to write Choice 1 (ordered 3rd)", "Click to write Choice 2 (ordered 1st)", "Click to write Choice 3 (ordered 2nd)"}) {
+		t.Errorf("QID18 levels = %v", got)
+	}
+	if got := s.Questions["QID17"].groups; !equalStrings(got, []string{"Group 3", "Group 1", "Group 2"}) {
+		t.Errorf("QID17 groups = %v", got)
+	}
+	if !s.Questions["QID1"].OrderedChoices() {
+		t.Errorf("QID1 choices are not ordered")
+	}
+
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	if err = s.WriteR(w, "test.csv"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, want := range []string{"\tsatisfaction = col_factor(levels = ", "\tQ7Label_text = col_double()", "\tQ11Label = col_character()"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("R script does not contain %q", want)
+		}
+	}
+}
+
+func TestApplyOverridesTypes(t *testing.T) {
+	tests := []struct {
+		types map[string]string
+		want  map[string]string
+	}{
+		{map[string]string{"QID16": "character", "Q16_click_count": "integer"}, map[string]string{"Q16_first_click": "col_character()", "Q16_click_count": "col_integer()"}},
+		{map[string]string{"Q16": "integer", "Q16_first_click": "double", "QID16": "character"}, map[string]string{"Q16_first_click": "col_double()", "Q16_click_count": "col_character()"}},
+		{map[string]string{"Q1Label": "double", "QID1": "character"}, map[string]string{"Q1Label": "col_double()"}},
+	}
+	for _, test := range tests {
+		// Repeat each test, since map iteration order varies between runs
+		for i := 0; i < 10; i++ {
+			s := readOverridesTestSurvey(t)
+			if s == nil {
+				return
+			}
+			s.ApplyOverrides(&Overrides{Types: test.types})
+			cols := s.csvCols()
+			types := s.csvColTypes()
+			for col, want := range test.want {
+				if j := indexOf(cols, col); j < 0 || types[j] != want {
+					t.Errorf("%v: type of %s = %v; want %s", test.types, col, types, want)
+				}
+			}
+		}
+	}
+}
+
+func TestApplyOverridesDropJSON(t *testing.T) {
+	s := readOverridesTestSurvey(t)
+	if s == nil {
+		return
+	}
+	s.ApplyOverrides(&Overrides{Drop: []string{"Q3"}})
+	var b bytes.Buffer
+	if err := s.WriteJSON(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var sj surveyJSON
+	if err := json.Unmarshal(b.Bytes(), &sj); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	for _, bj := range sj.Blocks {
+		if contains(bj.QuestionIDs, "QID3") {
+			t.Errorf("block %s lists dropped question QID3: %v", bj.ID, bj.QuestionIDs)
+		}
+	}
+	for _, qj := range sj.Questions {
+		if qj.ID == "QID3" {
+			t.Errorf("questions include dropped question QID3")
+		}
+	}
+	found := false
+	for _, ids := range s.original.blocks {
+		found = found || contains(ids, "QID3")
+	}
+	if !found {
+		t.Errorf("dropping QID3 changed the original survey's blocks")
+	}
+}
+
+func TestApplyOverridesMergeOtherVarName(t *testing.T) {
+	s := readOverridesTestSurvey(t)
+	if s == nil {
+		return
+	}
+	// Responses can name a choice by its variable name instead of its label
+	q := s.Questions["QID11"]
+	other := &q.choices[2]
+	other.VarName = "other"
+	for _, r := range s.Responses {
+		if r.answers["QID11"] == other.Label {
+			r.answers["QID11"] = other.VarName
+		}
+	}
+	s.ApplyOverrides(&Overrides{MergeOther: []string{"Q11"}})
+	want := []string{"Click to write Choice 2 (ordered 1st)", "other text", "-99", "other text"}
+	for i, r := range s.Responses {
+		if got := r.answers["QID11"]; got != want[i] {
+			t.Errorf("response %d: QID11 = %q; want %q", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+func TestWriteParquet(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteParquet(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	f, err := parquet.OpenFile(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if f.NumRows() != 4 {
+		t.Errorf("NumRows() = %d; want 4", f.NumRows())
+	}
+	fields := f.Schema().Fields()
+	cols := s.csvCols()
+	if len(fields) != len(cols) {
+		t.Errorf("len(fields) = %d; want %d", len(fields), len(cols))
+		return
+	}
+	for i, f := range fields {
+		if f.Name() != cols[i] {
+			t.Errorf("fields[%d] = '%s'; want '%s'", i, f.Name(), cols[i])
+		}
+	}
+
+	types := []struct {
+		col  string
+		want format.Type
+	}{
+		{"id", format.ByteArray},
+		{"finished", format.Boolean},
+		{"progress", format.Int64},
+		{"recorded", format.Int64},
+		{"Q1Label", format.ByteArray},
+		{"Q4Label_1", format.Boolean},
+		{"Q16_first_click", format.Double},
+	}
+	for _, test := range types {
+		col, ok := f.Schema().Lookup(test.col)
+		if !ok {
+			t.Errorf("missing column %s", test.col)
+			continue
+		}
+		if got := col.Node.Type().Kind(); got != parquet.Kind(test.want) {
+			t.Errorf("%s type = %s; want %s", test.col, got, test.want)
+		}
+	}
+	if col, ok := f.Schema().Lookup("recorded"); ok {
+		if lt := col.Node.Type().LogicalType(); lt == nil || lt.Timestamp == nil {
+			t.Errorf("recorded logical type = %v; want timestamp", lt)
+		}
+	}
+
+	wording, ok := f.Lookup(parquetWordingKey + "Q4Label_1")
+	if want := s.Questions["QID4"].Wording; !ok || wording != want {
+		t.Errorf("wording = '%s'; want '%s'", wording, want)
+	}
+
+	rows := make([]parquet.Row, 4)
+	r := parquet.NewReader(f)
+	if n, _ := r.ReadRows(rows); n != 4 {
+		t.Errorf("ReadRows() = %d; want 4", n)
+		return
+	}
+	values := []struct {
+		col  string
+		want string
+	}{
+		{"id", "R_1dtWhiBDD96nfyk"},
+		{"finished", "true"},
+		{"Q1Label", "Click to write Choice 1"},
+		{"Q16_first_click", "1.313"},
+		{"Q18Label", ""},
+	}
+	for _, test := range values {
+		col, _ := f.Schema().Lookup(test.col)
+		v := rows[0][col.ColumnIndex]
+		got := v.String()
+		if v.IsNull() {
+			got = ""
+		}
+		if got != test.want {
+			t.Errorf("%s = '%s'; want '%s'", test.col, got, test.want)
+		}
+	}
+}
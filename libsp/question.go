@@ -3,7 +3,9 @@ package libsp
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Question represents a survey question
@@ -11,6 +13,7 @@ type Question struct {
 	ID             string
 	Wording        string
 	label          string
+	labelIsText    bool // the label is Qualtrics' plain text copy of the wording, not one the author chose
 	qType          QType
 	choices        []Choice
 	subQuestions   []Choice
@@ -18,6 +21,13 @@ type Question struct {
 	orderedChoices bool
 	dataExportTag  string
 	dynChoices     *dynamicChoices
+	dataType       DataType
+	translations   map[string]string
+	language       string
+	colNames       map[string]string // column names set by Overrides, keyed by CSVCols() ID
+	colTypes       map[string]string // R column types set by Overrides, keyed by CSVCols() ID
+	nextChoiceID   int               // the QSF's NextChoiceId, so deleted choice IDs aren't reused
+	nextAnswerID   int               // the QSF's NextAnswerId, for questions whose choices are answers
 }
 
 // Choice represents one possible response to a survey question
@@ -26,6 +36,10 @@ type Choice struct {
 	Label   string
 	VarName string // short variable name for use in analysis scripts
 	HasText bool
+	Recode  string             // value Qualtrics uses for this choice in numeric exports
+	Scores  map[string]float64 // points awarded for this choice, keyed by scoring category ID
+	// Translations holds this choice's label in each translated language, keyed by language code
+	Translations map[string]string
 }
 
 type dynamicChoices struct {
@@ -38,14 +52,37 @@ func (q *Question) Type() QType {
 	return q.qType
 }
 
-// ResponseChoices returns a slice of Choice holding the ordered response choices available to survey respondents
+// DataType returns the type of values held by this question; currently only set for embedded data
+func (q *Question) DataType() DataType {
+	return q.dataType
+}
+
+// ResponseChoices returns a slice of Choice holding the ordered response choices available to survey respondents.
+// If a language has been selected with Survey.SetLanguage, choice labels are translated where possible.
 func (q *Question) ResponseChoices() []Choice {
-	return q.choices
+	if q.language == "" {
+		return q.choices
+	}
+	choices := make([]Choice, len(q.choices))
+	for i, c := range q.choices {
+		choices[i] = c
+		choices[i].Label = c.translatedLabel(q.language)
+	}
+	return choices
 }
 
-// SubQuestions returns a slice of Choice holding the subquestions asked as part of this question (e.g., rows of a matrix question)
+// SubQuestions returns a slice of Choice holding the subquestions asked as part of this question (e.g., rows of a matrix question).
+// If a language has been selected with Survey.SetLanguage, subquestion labels are translated where possible.
 func (q *Question) SubQuestions() []Choice {
-	return q.subQuestions
+	if q.language == "" {
+		return q.subQuestions
+	}
+	subQuestions := make([]Choice, len(q.subQuestions))
+	for i, sq := range q.subQuestions {
+		subQuestions[i] = sq
+		subQuestions[i].Label = sq.translatedLabel(q.language)
+	}
+	return subQuestions
 }
 
 // OrderedChoices returns true if this question has RecodeValues set, indicating that order matters
@@ -54,10 +91,26 @@ func (q *Question) OrderedChoices() bool {
 }
 
 var reSpaces = regexp.MustCompile(`[\s]+`)
+var reNonRChars = regexp.MustCompile(`[^a-zA-Z0-9_.]`)
 
 // CSVCols returns a slice of string holding the ordered CSV column names for this question
 func (q *Question) CSVCols() []string {
 	cols := make([]string, 0)
+	prefix := q.csvPrefix()
+	for _, s := range q.csvSuffixes() {
+		cols = append(cols, prefix+s)
+	}
+
+	// replace all non-R-compatible chars with '.'
+	for i, c := range cols {
+		cols[i] = reNonRChars.ReplaceAllString(c, ".")
+	}
+
+	return cols
+}
+
+// csvSuffixes returns the part of each of this question's CSV column names that follows the question's prefix
+func (q *Question) csvSuffixes() []string {
 	suffixes := []string{}
 	if q.qType == PickGroupRank {
 		for _, c := range q.choices {
@@ -73,25 +126,12 @@ func (q *Question) CSVCols() []string {
 	} else {
 		suffixes = q.qType.semanticSuffixes(q)
 	}
-
-	prefix := q.csvPrefix()
-	for _, s := range suffixes {
-		cols = append(cols, prefix+s)
-	}
-
-	// replace all non-R-compatible chars with '.'
-	r := regexp.MustCompile(`[^a-zA-Z0-9_.]`)
-	for i, c := range cols {
-		cols[i] = r.ReplaceAllString(c, ".")
-	}
-
-	return cols
+	return suffixes
 }
 
 // CSVPrefix returns a string prefix for all CSV column names for this question
 func (q *Question) csvPrefix() string {
-	// FIXME len <= 30 is a hack; need to check if q.label is an ellipsized variant of q.Wording
-	if q.label == "" || q.label == q.Wording || len(q.label) > 30 {
+	if q.label == "" || q.labelIsText || q.label == q.Wording {
 		if q.dataExportTag != "" {
 			return q.dataExportTag
 		}
@@ -105,7 +145,11 @@ func (q *Question) RColType() string {
 	switch q.qType {
 	case ConstantSum:
 		return "col_double()"
-	case Embedded, MatrixSingleResponse, MultipleChoiceSingleResponse, NPS, PickGroupRank, RankOrder:
+	case Meta:
+		return "col_character()"
+	case Embedded:
+		return q.dataType.rColType()
+	case MatrixSingleResponse, MultipleChoiceSingleResponse, NPS, PickGroupRank, RankOrder:
 		return "col_factor()"
 	}
 	return "col_logical()"
@@ -136,6 +180,9 @@ func (q *Question) ResponseCols(r *Response) []string {
 				// If the user answered this question, any unchecked options should be FALSE
 				isTxt := strings.HasSuffix(s, "_TEXT")
 				col = q.formatResponseForCol(r.answers[q.ID+s], isTxt)
+				if !isTxt {
+					col = q.translateAnswer(col)
+				}
 			}
 			cols = append(cols, col)
 		}
@@ -224,6 +271,59 @@ func (q *Question) formatResponseForCol(userAnswer string, isTxt bool) string {
 	return retval
 }
 
+// hasCodes returns true if this question's factor columns can be written as recode values
+func (q *Question) hasCodes(isRankCol bool) bool {
+	if isRankCol || q.qType == PickGroupRank || q.qType == RankOrder {
+		return false
+	}
+	return len(q.choices) > 0
+}
+
+// recodeCols replaces the choice labels in cols, as returned by ResponseCols, with their recode values
+func (q *Question) recodeCols(cols []string) []string {
+	recoded := make([]string, len(cols))
+	for i, colID := range q.CSVCols() {
+		recoded[i] = cols[i]
+		if rColType, isRankCol := getColType(colID, q); rColType == "col_factor()" && q.hasCodes(isRankCol) {
+			recoded[i] = q.recodeAnswer(cols[i])
+		}
+	}
+	return recoded
+}
+
+// recodeAnswer returns the recode value of the choice matching a
+func (q *Question) recodeAnswer(a string) string {
+	if a == "" {
+		return a
+	}
+	if a == noResponseConst {
+		return noResponseCode
+	}
+	for _, c := range q.choices {
+		if q.isAnswer(a, c) {
+			return c.code()
+		}
+	}
+	return a
+}
+
+// isAnswer returns true if the answer a selects c, one of q's choices. Responses name a choice by its label,
+// its variable name, or one of its translated labels.
+func (q *Question) isAnswer(a string, c Choice) bool {
+	return a == c.Label || (c.VarName != "" && a == c.VarName) || q.canonicalLabel(a) == c.Label
+}
+
+// code returns the value used for c in numeric exports
+func (c Choice) code() string {
+	if c.Label == noResponseConst {
+		return noResponseCode
+	}
+	if c.Recode != "" {
+		return c.Recode
+	}
+	return c.ID
+}
+
 func newQuestionFromPayload(p *qsfPayload) (*Question, error) {
 	q := new(Question)
 	q.ID = p.QuestionID
@@ -231,8 +331,14 @@ func newQuestionFromPayload(p *qsfPayload) (*Question, error) {
 	q.dataExportTag = p.DataExportTag
 	if p.QuestionDescription != "" {
 		q.label = p.QuestionDescription
+		// Unless the author specified a label, Qualtrics describes the question with its (possibly shortened) text
+		if config, ok := p.Configuration.(map[string]interface{}); ok {
+			q.labelIsText = config["QuestionDescriptionOption"] == "UseText"
+		}
 	}
 	q.qType = newQTypeFromString(p.QuestionType, p.Selector, p.SubSelector)
+	q.nextChoiceID = nextID(p.NextChoiceId)
+	q.nextAnswerID = nextID(p.NextAnswerId)
 	var err error
 	if q.qType.choicesAreQuestions() {
 		q.subQuestions, err = p.OrderedChoices(q.qType.choicesAreQuestions())
@@ -243,6 +349,9 @@ func newQuestionFromPayload(p *qsfPayload) (*Question, error) {
 		if err != nil {
 			return nil, fmt.Errorf("could not parse answers: %s", err)
 		}
+	} else if q.qType == Meta {
+		// Meta questions don't include a ChoiceOrder, so just use the order of the choice IDs
+		q.choices = p.MetaChoices()
 	} else {
 		q.choices, err = p.OrderedChoices(q.qType.choicesAreQuestions())
 		if err != nil {
@@ -250,6 +359,11 @@ func newQuestionFromPayload(p *qsfPayload) (*Question, error) {
 		}
 	}
 	q.groups = p.Groups
+	q.addTranslations(p.Translations())
+	grades := p.Grades()
+	for i, c := range q.choices {
+		q.choices[i].Scores = grades[c.ID]
+	}
 	// If we've recoded values in Qualtrics, that means order matters
 	q.orderedChoices = p.RecodeValues != nil
 
@@ -290,6 +404,7 @@ func newQuestionFromEmbeddedData(d *qsfEmbeddedData) (*Question, error) {
 	q.qType = Embedded
 	q.ID = d.Field
 	q.label = d.Field
+	q.dataType = newDataTypeFromString(d.VariableType)
 
 	return q, nil
 }
@@ -378,6 +493,94 @@ func (qt QType) String() string {
 	return s[qt]
 }
 
+// DataType represents the type of values held by an embedded data field
+type DataType int
+
+// Types of embedded data values
+const (
+	UnknownData DataType = iota
+	TextData
+	NumberData
+	DateData
+	DateTimeData
+	CategoricalData
+)
+
+// newDataTypeFromString returns the DataType corresponding to an embedded data field's VariableType
+func newDataTypeFromString(t string) DataType {
+	switch t {
+	case "String", "Text":
+		return TextData
+	case "Number", "NumberSet":
+		return NumberData
+	case "Date":
+		return DateData
+	case "TextSet", "MultiValueTextSet", "Nominal", "ScoringCategory":
+		return CategoricalData
+	}
+	return UnknownData
+}
+
+// inferDataType returns the narrowest DataType able to hold all of the given values
+func inferDataType(values []string) DataType {
+	isNumber, isDate, isDateTime := true, true, true
+	nValues := 0
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		nValues++
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			isNumber = false
+		}
+		if _, err := time.Parse(dateFormat, v); err != nil {
+			isDate = false
+		}
+		if _, err := time.Parse(timeFormat, v); err != nil {
+			isDateTime = false
+		}
+	}
+
+	switch {
+	case nValues == 0:
+		return UnknownData
+	case isNumber:
+		return NumberData
+	case isDate:
+		return DateData
+	case isDateTime:
+		return DateTimeData
+	}
+	return CategoricalData
+}
+
+func (dt DataType) String() string {
+	s := []string{
+		"Unknown",
+		"Text",
+		"Number",
+		"Date",
+		"DateTime",
+		"Categorical",
+	}
+	return s[dt]
+}
+
+// rColType returns the R column type used for values of this DataType
+func (dt DataType) rColType() string {
+	switch dt {
+	case TextData:
+		return "col_character()"
+	case NumberData:
+		return "col_double()"
+	case DateData:
+		return "col_date()"
+	case DateTimeData:
+		return "col_datetime()"
+	}
+	return "col_factor()"
+}
+
 func (qt QType) exportAsBools() bool {
 	switch qt {
 	case MultipleChoiceMultiResponse, MatrixMultiResponse:
@@ -418,6 +621,7 @@ func (qt QType) suffixes(q *Question, useExportTags bool) []string {
 	// RankOrder: [question id]_[choice id] (apparently not always; can also be [question id]_[choice order index (starts at 1)])
 	// TextEntry: [question id]_TEXT
 	// NPS: [question id] and [question id]_NPS_GROUP
+	// Meta: [question id]_BROWSER, [question id]_VERSION, [question id]_OS, etc.
 
 	textSuffix := "_TEXT"
 	npsSuffix := "_NPS_GROUP"
@@ -484,6 +688,17 @@ func (qt QType) suffixes(q *Question, useExportTags bool) []string {
 	case NPS:
 		suffixes = append(suffixes, "")
 		suffixes = append(suffixes, npsSuffix)
+	case Meta:
+		for _, f := range metaFields {
+			if f.optional && !q.hasChoiceLabel(f.label) {
+				continue
+			}
+			if useExportTags {
+				suffixes = append(suffixes, strings.ToLower(f.suffix))
+			} else {
+				suffixes = append(suffixes, f.suffix)
+			}
+		}
 	case TextEntry:
 		suffixes = append(suffixes, textSuffix)
 	case Timing:
@@ -493,6 +708,32 @@ func (qt QType) suffixes(q *Question, useExportTags bool) []string {
 	return suffixes
 }
 
+// metaField describes one of the sub-fields collected by a browser meta info question
+type metaField struct {
+	suffix   string
+	label    string
+	optional bool // only exported if the question includes a choice with this label
+}
+
+var metaFields = []metaField{
+	{"_BROWSER", "Browser", false},
+	{"_VERSION", "Version", false},
+	{"_OS", "Operating System", false},
+	{"_RESOLUTION", "Screen Resolution", false},
+	{"_FLASH", "Flash Version", true},
+	{"_USER_AGENT", "User Agent", true},
+}
+
+// hasChoiceLabel returns true if one of this question's choices has the given label
+func (q *Question) hasChoiceLabel(label string) bool {
+	for _, c := range q.choices {
+		if c.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
 func suffix(c Choice, useExportTags bool) string {
 	if useExportTags && c.VarName != "" {
 		return c.VarName
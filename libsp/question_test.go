@@ -17,3 +17,65 @@ func TestUnknownQType(t *testing.T) {
 		t.Errorf("QType = %s; wanted 'Unknown'", qt)
 	}
 }
+
+func TestMetaCSVCols(t *testing.T) {
+	q := &Question{ID: "QID1", dataExportTag: "Q1", qType: Meta}
+	q.choices = []Choice{{ID: "1", Label: "Browser"}, {ID: "2", Label: "Version"}, {ID: "7", Label: "User Agent"}}
+
+	want := []string{"Q1_browser", "Q1_version", "Q1_os", "Q1_resolution", "Q1_user_agent"}
+	cols := q.CSVCols()
+	if len(cols) != len(want) {
+		t.Errorf("len(CSVCols()) = %d; wanted %d (found %v)", len(cols), len(want), cols)
+		return
+	}
+	for i := range want {
+		if cols[i] != want[i] {
+			t.Errorf("CSVCols()[%d] = '%s'; wanted '%s'", i, cols[i], want[i])
+		}
+	}
+}
+
+func TestEmbeddedDataTypes(t *testing.T) {
+	tests := []struct {
+		variableType string
+		want         DataType
+		rColType     string
+	}{
+		{"String", TextData, "col_character()"},
+		{"Number", NumberData, "col_double()"},
+		{"Date", DateData, "col_date()"},
+		{"MultiValueTextSet", CategoricalData, "col_factor()"},
+		{"", UnknownData, "col_factor()"},
+	}
+	for _, test := range tests {
+		q, err := newQuestionFromEmbeddedData(&qsfEmbeddedData{Field: "f", VariableType: test.variableType})
+		if err != nil {
+			t.Errorf("err = %s", err)
+			continue
+		}
+		if q.DataType() != test.want {
+			t.Errorf("DataType() for '%s' = %s; wanted %s", test.variableType, q.DataType(), test.want)
+		}
+		if q.RColType() != test.rColType {
+			t.Errorf("RColType() for '%s' = %s; wanted %s", test.variableType, q.RColType(), test.rColType)
+		}
+	}
+}
+
+func TestInferDataType(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   DataType
+	}{
+		{[]string{"", ""}, UnknownData},
+		{[]string{"1", "", "2.5"}, NumberData},
+		{[]string{"2020-11-09", "2020-11-10"}, DateData},
+		{[]string{"2020-11-09 13:12:11", ""}, DateTimeData},
+		{[]string{"1", "a"}, CategoricalData},
+	}
+	for _, test := range tests {
+		if dt := inferDataType(test.values); dt != test.want {
+			t.Errorf("inferDataType(%v) = %s; wanted %s", test.values, dt, test.want)
+		}
+	}
+}
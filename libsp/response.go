@@ -8,12 +8,69 @@ import (
 
 // Response models a Qualtrics participant response
 type Response struct {
-	ID         string
-	Progress   int
-	Duration   int
-	Finished   bool
-	RecordedOn time.Time
-	answers    map[string]string
+	ID                  string
+	Progress            int
+	Duration            int
+	Finished            bool
+	RecordedOn          time.Time
+	StartedOn           time.Time
+	EndedOn             time.Time
+	Status              string
+	IPAddress           string
+	LocationLatitude    string
+	LocationLongitude   string
+	DistributionChannel string
+	UserLanguage        string
+	RecipientLastName   string
+	RecipientFirstName  string
+	RecipientEmail      string
+	ExternalReference   string
+	answers             map[string]string
+}
+
+// IsPreview returns true if r was recorded from a survey preview or test run rather than a participant
+func (r *Response) IsPreview() bool {
+	switch r.Status {
+	// Text exports use the status label, numeric exports use its code
+	case "Survey Preview", "Survey Test", "Offline Survey Preview", "1", "2", "17":
+		return true
+	}
+	switch r.DistributionChannel {
+	case "preview", "test":
+		return true
+	}
+	return false
+}
+
+// metadataCol describes an optional CSV column holding response metadata
+type metadataCol struct {
+	name     string
+	rColType string
+	pii      bool // true if this column may identify the respondent
+	value    func(r *Response) string
+}
+
+var metadataCols = []metadataCol{
+	{"start", "col_datetime()", false, func(r *Response) string { return formatTime(r.StartedOn) }},
+	{"end", "col_datetime()", false, func(r *Response) string { return formatTime(r.EndedOn) }},
+	{"status", "col_factor()", false, func(r *Response) string { return r.Status }},
+	{"ip_address", "col_character()", true, func(r *Response) string { return r.IPAddress }},
+	{"latitude", "col_double()", true, func(r *Response) string { return r.LocationLatitude }},
+	{"longitude", "col_double()", true, func(r *Response) string { return r.LocationLongitude }},
+	{"channel", "col_factor()", false, func(r *Response) string { return r.DistributionChannel }},
+	{"language", "col_factor()", false, func(r *Response) string { return r.UserLanguage }},
+	{"recipient_last_name", "col_character()", true, func(r *Response) string { return r.RecipientLastName }},
+	{"recipient_first_name", "col_character()", true, func(r *Response) string { return r.RecipientFirstName }},
+	{"recipient_email", "col_character()", true, func(r *Response) string { return r.RecipientEmail }},
+	{"external_reference", "col_character()", true, func(r *Response) string { return r.ExternalReference }},
+}
+
+// formatTime returns t in the format used for CSV output, or an empty string if t is not set
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeFormat)
 }
 
 // NewResponse creates and initializes a Response
@@ -0,0 +1,85 @@
+package libsp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ScoringCategory represents one of a survey's scoring categories
+type ScoringCategory struct {
+	ID   string
+	Name string
+}
+
+// csvCol returns the CSV column name used for this category's scores
+func (c ScoringCategory) csvCol() string {
+	name := c.Name
+	if name == "" {
+		name = c.ID
+	}
+	return reNonRChars.ReplaceAllString("score_"+name, ".")
+}
+
+// Score returns the total points r earned in the scoring category with the given ID
+func (s *Survey) Score(r *Response, categoryID string) float64 {
+	total := 0.0
+	for _, id := range s.QuestionOrder {
+		total += s.Questions[id].score(r, categoryID)
+	}
+	return total
+}
+
+// ScoreMismatches compares computed scores with any scores Qualtrics exported alongside the responses,
+// returning a description of each difference
+func (s *Survey) ScoreMismatches() []string {
+	mismatches := []string{}
+	for _, r := range s.Responses {
+		for _, c := range s.Scoring {
+			exported, ok := r.answers[c.ID]
+			if !ok || exported == "" {
+				continue
+			}
+			want, err := strconv.ParseFloat(exported, 64)
+			if err != nil {
+				mismatches = append(mismatches, fmt.Sprintf("response %s: could not parse exported %s score '%s'", r.ID, c.Name, exported))
+				continue
+			}
+			if got := s.Score(r, c.ID); got != want {
+				mismatches = append(mismatches, fmt.Sprintf("response %s: computed %s score %s; Qualtrics exported %s", r.ID, c.Name, formatScore(got), exported))
+			}
+		}
+	}
+	return mismatches
+}
+
+// score returns the points r earned for this question in the given scoring category.
+// Only multiple choice questions are currently scored.
+func (q *Question) score(r *Response, categoryID string) float64 {
+	total := 0.0
+	switch q.qType {
+	case MultipleChoiceSingleResponse:
+		a := r.answers[q.ID]
+		if a == "" || isNoResponseCode(a) {
+			return 0
+		}
+		for _, c := range q.choices {
+			if a == c.Label || (c.VarName != "" && a == c.VarName) {
+				total += c.Scores[categoryID]
+				break
+			}
+		}
+	case MultipleChoiceMultiResponse:
+		for _, c := range q.choices {
+			a := r.answers[q.ID+"_"+c.ID]
+			if a != "" && !isNoResponseCode(a) {
+				total += c.Scores[categoryID]
+			}
+		}
+	}
+	return total
+}
+
+// formatScore returns f formatted for CSV output
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
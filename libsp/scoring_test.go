@@ -0,0 +1,94 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func readScoringSurvey(t *testing.T) *Survey {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfScoringContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlScoringContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return nil
+	}
+	return s
+}
+
+func TestReadQsfScoring(t *testing.T) {
+	s := readScoringSurvey(t)
+	if s == nil {
+		return
+	}
+	if len(s.Scoring) != 1 {
+		t.Errorf("len(Scoring) = %d; want 1", len(s.Scoring))
+		return
+	}
+	if s.Scoring[0].ID != "SC_knowledge" || s.Scoring[0].Name != "Knowledge" {
+		t.Errorf("Scoring[0] = %v; want {SC_knowledge Knowledge}", s.Scoring[0])
+	}
+	tests := []struct {
+		qid    string
+		choice int
+		want   float64
+	}{
+		{"QID1", 0, 1},
+		{"QID1", 1, 0},
+		{"QID2", 1, -1},
+		{"QID2", 2, 2.5},
+	}
+	for _, test := range tests {
+		c := s.Questions[test.qid].ResponseChoices()[test.choice]
+		if c.Scores["SC_knowledge"] != test.want {
+			t.Errorf("Questions[%s].Choices[%d].Scores = %v; want %v", test.qid, test.choice, c.Scores, test.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	s := readScoringSurvey(t)
+	if s == nil {
+		return
+	}
+	want := []float64{5.5, -1}
+	for i, r := range s.Responses {
+		if got := s.Score(r, "SC_knowledge"); got != want[i] {
+			t.Errorf("Score(Responses[%d]) = %v; want %v", i, got, want[i])
+		}
+	}
+
+	mismatches := s.ScoreMismatches()
+	if len(mismatches) != 1 {
+		t.Errorf("len(ScoreMismatches()) = %d; want 1", len(mismatches))
+	} else if mismatches[0] != "response R_2: computed Knowledge score -1; Qualtrics exported 0" {
+		t.Errorf("ScoreMismatches()[0] = '%s'", mismatches[0])
+	}
+}
+
+func TestWriteCSVScores(t *testing.T) {
+	s := readScoringSurvey(t)
+	if s == nil {
+		return
+	}
+	var b bytes.Buffer
+	if err := s.WriteCSV(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	want := []string{"score_Knowledge", "5.5", "-1"}
+	for i, record := range records {
+		if last := record[len(record)-1]; last != want[i] {
+			t.Errorf("row %d, last column = '%s'; want '%s'", i, last, want[i])
+		}
+	}
+}
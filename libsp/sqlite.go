@@ -0,0 +1,235 @@
+package libsp
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	// Register the pure-Go "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE survey (
+	id TEXT PRIMARY KEY,
+	title TEXT,
+	description TEXT,
+	status TEXT,
+	language TEXT,
+	created TEXT,
+	launched TEXT,
+	modified TEXT
+);
+CREATE TABLE blocks (
+	id TEXT PRIMARY KEY,
+	position INTEGER,
+	type TEXT,
+	description TEXT
+);
+CREATE TABLE questions (
+	id TEXT PRIMARY KEY,
+	block_id TEXT REFERENCES blocks(id),
+	position INTEGER,
+	type TEXT,
+	export_tag TEXT,
+	label TEXT,
+	wording TEXT
+);
+CREATE TABLE choices (
+	question_id TEXT REFERENCES questions(id),
+	choice_id TEXT,
+	position INTEGER,
+	is_subquestion INTEGER,
+	label TEXT,
+	var_name TEXT,
+	recode TEXT,
+	has_text INTEGER,
+	PRIMARY KEY (question_id, is_subquestion, choice_id)
+);
+CREATE TABLE answers (
+	response_id TEXT REFERENCES responses(id),
+	question_id TEXT REFERENCES questions(id),
+	column_name TEXT,
+	subquestion TEXT,
+	choice TEXT,
+	value TEXT,
+	PRIMARY KEY (response_id, column_name)
+);
+CREATE TABLE scores (
+	response_id TEXT REFERENCES responses(id),
+	category_id TEXT,
+	category TEXT,
+	score REAL,
+	PRIMARY KEY (response_id, category_id)
+);
+`
+
+// WriteSQLite saves the parsed survey and its responses to a new SQLite database at path, replacing any existing file.
+// The database holds normalized survey, blocks, questions, choices, responses, answers, and scores tables,
+// plus a responses_wide view with the same columns as WriteCSV.
+func (s *Survey) WriteSQLite(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not replace '%s': %s", path, err)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("could not open database: %s", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %s", err)
+	}
+	if err := s.writeSQLiteTables(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %s", err)
+	}
+	return nil
+}
+
+func (s *Survey) writeSQLiteTables(tx *sql.Tx) error {
+	metadataCols := s.allMetadataCols()
+	schema := sqliteSchema + "CREATE TABLE responses (\n\tid TEXT PRIMARY KEY,\n\tfinished INTEGER,\n\tprogress INTEGER,\n\tduration INTEGER,\n\trecorded TEXT"
+	for _, mc := range metadataCols {
+		schema += ",\n\t" + mc.name + " " + mc.sqliteType()
+	}
+	schema += "\n);\n"
+	if _, err := tx.Exec(schema); err != nil {
+		return fmt.Errorf("could not create tables: %s", err)
+	}
+
+	_, err := tx.Exec("INSERT INTO survey VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		s.ID, s.Title, s.Description, s.Status, s.Language, formatTime(s.CreatedOn), formatTime(s.LaunchedOn), formatTime(s.ModifiedOn))
+	if err != nil {
+		return fmt.Errorf("could not insert survey: %s", err)
+	}
+
+	questionBlocks := make(map[string]string)
+	for i, id := range s.blockOrder {
+		b := s.blocks[id]
+		if b == nil {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO blocks VALUES (?, ?, ?, ?)", b.ID, i, b.Type, b.Description); err != nil {
+			return fmt.Errorf("could not insert block %s: %s", b.ID, err)
+		}
+		for _, qid := range b.QuestionIDs {
+			questionBlocks[qid] = b.ID
+		}
+	}
+
+	for i, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		var blockID interface{}
+		if b, ok := questionBlocks[id]; ok {
+			blockID = b
+		}
+		_, err := tx.Exec("INSERT INTO questions VALUES (?, ?, ?, ?, ?, ?, ?)", q.ID, blockID, i, q.qType.String(), q.dataExportTag, q.label, q.Wording)
+		if err != nil {
+			return fmt.Errorf("could not insert question %s: %s", q.ID, err)
+		}
+		if err := insertChoices(tx, q.ID, q.ResponseChoices(), false); err != nil {
+			return err
+		}
+		if err := insertChoices(tx, q.ID, q.SubQuestions(), true); err != nil {
+			return err
+		}
+	}
+
+	names := s.columnNames()
+	for _, r := range s.Responses {
+		values := []interface{}{r.ID, r.Finished, r.Progress, r.Duration, formatTime(r.RecordedOn)}
+		for _, mc := range metadataCols {
+			values = append(values, mc.value(r))
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		if _, err := tx.Exec("INSERT INTO responses VALUES ("+placeholders+")", values...); err != nil {
+			return fmt.Errorf("could not insert response %s: %s", r.ID, err)
+		}
+		if err := s.insertAnswers(tx, r, names); err != nil {
+			return err
+		}
+		for _, c := range s.Scoring {
+			_, err := tx.Exec("INSERT INTO scores VALUES (?, ?, ?, ?)", r.ID, c.ID, c.Name, s.Score(r, c.ID))
+			if err != nil {
+				return fmt.Errorf("could not insert %s score for response %s: %s", c.Name, r.ID, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(s.sqliteWideView(names)); err != nil {
+		return fmt.Errorf("could not create responses_wide view: %s", err)
+	}
+	return nil
+}
+
+func insertChoices(tx *sql.Tx, qid string, choices []Choice, isSubQuestion bool) error {
+	for i, c := range choices {
+		_, err := tx.Exec("INSERT OR IGNORE INTO choices VALUES (?, ?, ?, ?, ?, ?, ?, ?)", qid, c.ID, i, isSubQuestion, c.Label, c.VarName, c.Recode, c.HasText)
+		if err != nil {
+			return fmt.Errorf("could not insert choice %s of question %s: %s", c.ID, qid, err)
+		}
+	}
+	return nil
+}
+
+// insertAnswers stores each non-empty cell of r that WriteCSV would write
+func (s *Survey) insertAnswers(tx *sql.Tx, r *Response, names *columnNames) error {
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		cols := q.ResponseCols(r)
+		if s.NumericCodes {
+			cols = q.recodeCols(cols)
+		}
+		details := q.longCols()
+		for i, name := range names.questions[id] {
+			if cols[i] == "" {
+				continue
+			}
+			_, err := tx.Exec("INSERT INTO answers VALUES (?, ?, ?, ?, ?, ?)", r.ID, q.ID, name, details[i].subquestion, details[i].choice, cols[i])
+			if err != nil {
+				return fmt.Errorf("could not insert answer %s for response %s: %s", name, r.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteWideView returns a statement creating a view with one row per response and the same columns as WriteCSV
+func (s *Survey) sqliteWideView(names *columnNames) string {
+	cols := []string{"r.id AS id", "r.finished AS finished", "r.progress AS progress", "r.duration AS duration", "r.recorded AS recorded"}
+	for _, mc := range s.metadataCols() {
+		cols = append(cols, fmt.Sprintf("r.%s AS %s", mc.name, mc.name))
+	}
+	for _, id := range s.QuestionOrder {
+		for _, name := range names.questions[id] {
+			cols = append(cols, fmt.Sprintf("MAX(CASE WHEN a.column_name = %s THEN a.value END) AS %s", sqlString(name), sqlIdentifier(name)))
+		}
+	}
+	for i, c := range s.Scoring {
+		cols = append(cols, fmt.Sprintf("(SELECT score FROM scores WHERE response_id = r.id AND category_id = %s) AS %s", sqlString(c.ID), sqlIdentifier(names.scoring[i])))
+	}
+	return "CREATE VIEW responses_wide AS SELECT\n\t" + strings.Join(cols, ",\n\t") +
+		"\nFROM responses r LEFT JOIN answers a ON a.response_id = r.id\nGROUP BY r.id\nORDER BY r.rowid;"
+}
+
+// sqliteType returns the SQLite column type used for this metadata column
+func (mc metadataCol) sqliteType() string {
+	if mc.rColType == "col_double()" {
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlIdentifier(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
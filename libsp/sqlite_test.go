@@ -0,0 +1,86 @@
+package libsp
+
+import (
+	"bufio"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSQLite(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	path := filepath.Join(t.TempDir(), "survey.sqlite")
+	// Writing twice checks that an existing database is replaced
+	for i := 0; i < 2; i++ {
+		if err = s.WriteSQLite(path); err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	defer db.Close()
+
+	var title string
+	if err = db.QueryRow("SELECT title FROM survey").Scan(&title); err != nil {
+		t.Errorf("err = %s", err)
+	} else if title != "Test survey" {
+		t.Errorf("title = '%s'; want 'Test survey'", title)
+	}
+
+	counts := []struct {
+		table string
+		want  int
+	}{
+		{"blocks", len(s.blockOrder)},
+		{"questions", len(s.QuestionOrder)},
+		{"responses", 4},
+		{"responses_wide", 4},
+	}
+	for _, test := range counts {
+		var n int
+		if err = db.QueryRow("SELECT COUNT(*) FROM " + test.table).Scan(&n); err != nil {
+			t.Errorf("%s: err = %s", test.table, err)
+		} else if n != test.want {
+			t.Errorf("COUNT(%s) = %d; want %d", test.table, n, test.want)
+		}
+	}
+
+	var label string
+	err = db.QueryRow("SELECT label FROM choices WHERE question_id = 'QID5' AND is_subquestion = 1 AND position = 3").Scan(&label)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	} else if label != "Other:" {
+		t.Errorf("QID5 subquestion 3 label = '%s'; want 'Other:'", label)
+	}
+
+	var q1, q5 string
+	var q18 sql.NullString
+	err = db.QueryRow(`SELECT Q1Label, Q18Label, "Q5Label_statement2" FROM responses_wide WHERE id = 'R_1dtWhiBDD96nfyk'`).Scan(&q1, &q18, &q5)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	} else {
+		if q1 != "Click to write Choice 1" {
+			t.Errorf("Q1Label = '%s'; want 'Click to write Choice 1'", q1)
+		}
+		if q18.Valid {
+			t.Errorf("Q18Label = '%s'; want NULL", q18.String)
+		}
+		if q5 != "scale2" {
+			t.Errorf("Q5Label_statement2 = '%s'; want 'scale2'", q5)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package libsp
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ColumnStats summarizes the values of one of a survey's question or score columns across its responses
+type ColumnStats struct {
+	Column     string       `json:"column"`
+	QuestionID string       `json:"question_id,omitempty"` // empty for score columns
+	Type       string       `json:"type"`                  // R column type without the col_ prefix, e.g. "factor"
+	Answered   int          `json:"answered"`              // responses with a value in this column
+	Missing    int          `json:"missing"`               // responses without a value (NA) in this column
+	Counts     []LevelCount `json:"counts,omitempty"`      // factor and logical columns: responses with each value, in level order
+	Distinct   int          `json:"distinct,omitempty"`    // character columns: number of different values
+	Min        *float64     `json:"min,omitempty"`         // numeric columns
+	Mean       *float64     `json:"mean,omitempty"`
+	Max        *float64     `json:"max,omitempty"`
+}
+
+// LevelCount is the number of responses with a given value in a factor or logical column
+type LevelCount struct {
+	Level string `json:"level"`
+	N     int    `json:"n"`
+}
+
+// Stats summarizes each question and score column of WriteCSV's output.
+// Factor columns count every level, including those no respondent chose; values that aren't levels follow in sorted order.
+func (s *Survey) Stats() []ColumnStats {
+	entries := s.codebook()
+	first := len(responseCols) + len(s.metadataCols())
+	values := make([][]string, len(entries))
+	for _, r := range s.Responses {
+		for i, v := range s.csvRow(r)[first:] {
+			values[first+i] = append(values[first+i], v)
+		}
+	}
+
+	stats := []ColumnStats{}
+	for i, e := range entries[first:] {
+		cs := ColumnStats{Column: e.column, QuestionID: e.questionID, Type: e.colType}
+		counts := make(map[string]int)
+		for _, v := range values[first+i] {
+			if v == "" {
+				cs.Missing++
+				continue
+			}
+			cs.Answered++
+			counts[v]++
+		}
+		switch e.colType {
+		case "factor", "logical":
+			levels := []string{}
+			for _, l := range e.levels {
+				// In numeric mode, levels are described as "code = label"
+				if s.NumericCodes {
+					l = strings.SplitN(l, " = ", 2)[0]
+				}
+				levels = append(levels, l)
+			}
+			if e.colType == "logical" {
+				levels = []string{"TRUE", "FALSE"}
+			}
+			others := []string{}
+			for v := range counts {
+				if !contains(levels, v) {
+					others = append(others, v)
+				}
+			}
+			sort.Strings(others)
+			for _, l := range append(levels, others...) {
+				cs.Counts = append(cs.Counts, LevelCount{l, counts[l]})
+			}
+		case "double", "integer":
+			cs.Min, cs.Mean, cs.Max = summarizeNumbers(values[first+i])
+		default:
+			cs.Distinct = len(counts)
+		}
+		stats = append(stats, cs)
+	}
+	return stats
+}
+
+// summarizeNumbers returns the minimum, mean, and maximum of the numbers in values, or nils if there aren't any
+func summarizeNumbers(values []string) (min, mean, max *float64) {
+	n := 0
+	total := 0.0
+	for _, v := range values {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+		if n == 0 {
+			min, max = new(float64), new(float64)
+			*min, *max = f, f
+		} else if f < *min {
+			*min = f
+		} else if f > *max {
+			*max = f
+		}
+		total += f
+		n++
+	}
+	if n > 0 {
+		mean = new(float64)
+		*mean = total / float64(n)
+	}
+	return min, mean, max
+}
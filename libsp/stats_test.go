@@ -0,0 +1,62 @@
+package libsp
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	tests := []struct {
+		column  string
+		want    ColumnStats
+		summary string
+		numeric bool
+	}{
+		{"Q1Label", ColumnStats{Column: "Q1Label", QuestionID: "QID1", Type: "factor", Answered: 4},
+			"Click to write Choice 1=2 Click to write Choice 2=1 Click to write Choice 3=1 No response=0", false},
+		{"Q1Label", ColumnStats{Column: "Q1Label", QuestionID: "QID1", Type: "double", Answered: 4}, "min=1 mean=1.75 max=3", true},
+		{"Q4Label_3", ColumnStats{Column: "Q4Label_3", QuestionID: "QID4", Type: "logical", Answered: 4}, "TRUE=2 FALSE=2", false},
+		{"Q7Label_text", ColumnStats{Column: "Q7Label_text", QuestionID: "QID7", Type: "character", Answered: 3, Missing: 1, Distinct: 3}, "", false},
+		{"Q16_click_count", ColumnStats{Column: "Q16_click_count", QuestionID: "QID16", Type: "integer", Answered: 3, Missing: 1}, "min=9 mean=11.33 max=15", false},
+	}
+	for _, test := range tests {
+		s.NumericCodes = test.numeric
+		stats := s.Stats()
+		if len(stats) != len(s.csvCols())-len(responseCols) {
+			t.Errorf("len(Stats()) = %d; want %d", len(stats), len(s.csvCols())-len(responseCols))
+			return
+		}
+		for _, got := range stats {
+			if got.Column != test.column {
+				continue
+			}
+			if got.QuestionID != test.want.QuestionID || got.Type != test.want.Type || got.Answered != test.want.Answered ||
+				got.Missing != test.want.Missing || got.Distinct != test.want.Distinct {
+				t.Errorf("%s: Stats() = %+v; want %+v", test.column, got, test.want)
+			}
+			summary := []string{}
+			for _, c := range got.Counts {
+				summary = append(summary, c.Level+"="+strconv.Itoa(c.N))
+			}
+			if got.Mean != nil {
+				summary = append(summary, fmt.Sprintf("min=%g mean=%.2f max=%g", *got.Min, *got.Mean, *got.Max))
+			}
+			if strings.Join(summary, " ") != test.summary {
+				t.Errorf("%s: summary = '%s'; want '%s'", test.column, strings.Join(summary, " "), test.summary)
+			}
+		}
+	}
+}
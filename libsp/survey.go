@@ -2,6 +2,7 @@ package libsp
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/sha1"
 	"encoding/csv"
 	"encoding/json"
@@ -25,27 +26,40 @@ import (
 
 // Survey represents a survey, including its questions, potential responses, and meta-data
 type Survey struct {
-	Title         string
-	Description   string
-	Status        string
-	CreatedOn     time.Time
-	LaunchedOn    time.Time
-	ModifiedOn    time.Time
-	QuestionOrder []string
-	Questions     map[string]*Question
-	Responses     []*Response
-	blocks        map[string]*block
-	blockOrder    []string
+	ID              string
+	Title           string
+	Description     string
+	Status          string
+	Language        string // code of the survey's default language, e.g. "EN"
+	CreatedOn       time.Time
+	LaunchedOn      time.Time
+	ModifiedOn      time.Time
+	QuestionOrder   []string
+	Questions       map[string]*Question
+	Responses       []*Response
+	Scoring         []ScoringCategory
+	NumericCodes    bool           // write choices' recode values instead of their labels
+	IncludeMetadata bool           // include response metadata (dates, status, location, etc.) in CSV output
+	ExcludePII      bool           // omit metadata columns that may identify respondents
+	Naming          NamingStrategy // chooses CSV column names; nil uses DefaultNaming
+	blocks          map[string]*block
+	blockOrder      []string
+	qsfDoc          qsfObject       // the QSF this survey was read from, for WriteQsf
+	original        *surveySnapshot // the survey as it was read, for WriteQsf
 }
 
 // Version of libsp
 const Version = "0.2.1"
 const timeFormat = "2006-01-02 15:04:05"
+const dateFormat = "2006-01-02"
 const noResponseConst = "No response"
 const noResponseCode = "-99"
 const noResponseCodeMulti = "0"
 const notGrouped = "Not grouped"
 
+// responseCols are the columns written for every response, before any metadata or question columns
+var responseCols = []string{"id", "finished", "progress", "duration", "recorded"}
+
 // WriteCSV saves the parsed survey questions and responses in comma-separated value format
 func (s *Survey) WriteCSV(bw *bufio.Writer) error {
 	if bw == nil {
@@ -58,13 +72,7 @@ func (s *Survey) WriteCSV(bw *bufio.Writer) error {
 		return fmt.Errorf("could not write CSV columns: %s", err)
 	}
 	for _, r := range s.Responses {
-		row := []string{r.ID, fmt.Sprintf("%t", r.Finished), fmt.Sprintf("%d", r.Progress), fmt.Sprintf("%d", r.Duration), fmt.Sprintf("%s", r.RecordedOn.Format(timeFormat))}
-
-		for _, id := range s.QuestionOrder {
-			q := s.Questions[id]
-			row = append(row, q.ResponseCols(r)...)
-		}
-		err = w.Write(row)
+		err = w.Write(s.csvRow(r))
 		if err != nil {
 			return fmt.Errorf("could not write CSV row: %s", err)
 		}
@@ -80,10 +88,193 @@ func (s *Survey) WriteCSV(bw *bufio.Writer) error {
 
 // csvCols returns a slice of string holding the column headers
 func (s *Survey) csvCols() []string {
-	cols := []string{"id", "finished", "progress", "duration", "recorded"}
+	cols := append([]string{}, responseCols...)
+	for _, mc := range s.metadataCols() {
+		cols = append(cols, mc.name)
+	}
+	names := s.columnNames()
+	for _, id := range s.QuestionOrder {
+		cols = append(cols, names.questions[id]...)
+	}
+	cols = append(cols, names.scoring...)
+	return cols
+}
+
+// rReservedWords can't be used as R variable names
+var rReservedWords = map[string]bool{
+	"if": true, "else": true, "repeat": true, "while": true, "function": true, "for": true, "in": true, "next": true, "break": true,
+	"TRUE": true, "FALSE": true, "NULL": true, "Inf": true, "NaN": true, "NA": true,
+	"NA_integer_": true, "NA_real_": true, "NA_character_": true, "NA_complex_": true,
+}
+
+// columnNames holds the names of a survey's question and scoring columns, after resolving collisions
+type columnNames struct {
+	questions map[string][]string // keyed by question ID, in the same order as Question.CSVCols()
+	scoring   []string            // in the same order as Survey.Scoring
+	renamed   []columnRename      // in the order the columns were named
+}
+
+// columnRename describes a column that columnNames renamed
+type columnRename struct {
+	questionID string // empty for scoring columns
+	owner      string // the question ID, or the scoring category
+	from       string
+	to         string
+	usedBy     string // the owner of the column that already had the name, or empty if the name isn't valid in R
+}
+
+// message describes the rename without its owner
+func (r columnRename) message() string {
+	if r.usedBy == "" {
+		return fmt.Sprintf("column '%s' is not a valid R name; renamed to '%s'", r.from, r.to)
+	}
+	return fmt.Sprintf("column '%s' is already used by %s; renamed to '%s'", r.from, r.usedBy, r.to)
+}
+
+// columnNames returns the name of each question and scoring column, as chosen by the survey's NamingStrategy.
+// Like R's make.names(), names starting with a digit or underscore get an "X" prefix and reserved words get a "." suffix.
+// Like make.unique(), names already used by an earlier column get a ".1", ".2", etc. suffix. Response columns (e.g., id) count as used,
+// as do the metadata columns that IncludeMetadata and ExcludePII add to the output.
+func (s *Survey) columnNames() *columnNames {
+	names := &columnNames{questions: make(map[string][]string)}
+	naming := s.naming()
+	maxLength := s.maxNameLength()
+	used := make(map[string]string) // the owner of each name
+	for _, col := range responseCols {
+		used[col] = "response data"
+	}
+	for _, mc := range s.metadataCols() {
+		used[mc.name] = "response metadata"
+	}
+	// suffix is the part of col that identifies the column within its question; shortening keeps it
+	resolve := func(questionID, owner, col, suffix string) string {
+		name := validRName(col)
+		if name != col {
+			names.renamed = append(names.renamed, columnRename{questionID: questionID, owner: owner, from: col, to: name})
+		}
+		// The length limit was asked for, so shortened names aren't reported as renamed
+		name = shortenName(name, suffix, maxLength)
+		if usedBy, ok := used[name]; ok {
+			base := name
+			for i := 1; used[name] != ""; i++ {
+				n := fmt.Sprintf(".%d", i)
+				name = shortenName(base+n, n, maxLength)
+			}
+			names.renamed = append(names.renamed, columnRename{questionID: questionID, owner: owner, from: base, to: name, usedBy: usedBy})
+		}
+		used[name] = owner
+		return name
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		cols := []string{}
+		colIDs := q.CSVCols()
+		for i, suffix := range q.csvSuffixes() {
+			col, ok := q.colNames[colIDs[i]]
+			if !ok {
+				col = naming.ColumnName(q, suffix)
+			}
+			col = reNonRChars.ReplaceAllString(col, ".")
+			cols = append(cols, resolve(id, id, col, reNonRChars.ReplaceAllString(suffix, ".")))
+		}
+		names.questions[id] = cols
+	}
+	for _, c := range s.Scoring {
+		names.scoring = append(names.scoring, resolve("", "scoring category "+c.ID, c.csvCol(), ""))
+	}
+	return names
+}
+
+// validRName returns name, changed if needed to be a syntactically valid R name
+func validRName(name string) string {
+	if name == "" {
+		return "X"
+	}
+	if c := name[0]; (c >= '0' && c <= '9') || c == '_' || (c == '.' && len(name) > 1 && name[1] >= '0' && name[1] <= '9') {
+		name = "X" + name
+	}
+	if rReservedWords[name] {
+		name += "."
+	}
+	return name
+}
+
+// RenamedColumns describes each column that sp renamed because its name was already used by another column or isn't valid in R
+func (s *Survey) RenamedColumns() []string {
+	renamed := []string{}
+	for _, r := range s.columnNames().renamed {
+		renamed = append(renamed, r.owner+": "+r.message())
+	}
+	return renamed
+}
+
+// ColumnNames returns the CSV column names of each question, keyed by question ID and in the same order as Question.CSVCols(),
+// after renaming columns that collide or aren't valid in R
+func (s *Survey) ColumnNames() map[string][]string {
+	return s.columnNames().questions
+}
+
+// csvRow returns a slice of string holding the values of r for each column in csvCols()
+func (s *Survey) csvRow(r *Response) []string {
+	row := []string{r.ID, fmt.Sprintf("%t", r.Finished), fmt.Sprintf("%d", r.Progress), fmt.Sprintf("%d", r.Duration), fmt.Sprintf("%s", r.RecordedOn.Format(timeFormat))}
+	for _, mc := range s.metadataCols() {
+		row = append(row, mc.value(r))
+	}
+
 	for _, id := range s.QuestionOrder {
 		q := s.Questions[id]
-		cols = append(cols, q.CSVCols()...)
+		cols := q.ResponseCols(r)
+		if s.NumericCodes {
+			cols = q.recodeCols(cols)
+		}
+		row = append(row, cols...)
+	}
+	for _, c := range s.Scoring {
+		row = append(row, formatScore(s.Score(r, c.ID)))
+	}
+	return row
+}
+
+// csvColTypes returns the R type of each column in csvCols(), e.g. "col_factor()"
+func (s *Survey) csvColTypes() []string {
+	types := []string{"col_character()", "col_logical()", "col_integer()", "col_integer()", "col_datetime()"}
+	for _, mc := range s.metadataCols() {
+		types = append(types, mc.rColType)
+	}
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		for _, colID := range q.CSVCols() {
+			rColType, isRankCol := getColType(colID, q)
+			if rColType == "" {
+				rColType = "col_character()"
+			} else if rColType == "col_factor()" && s.NumericCodes && q.hasCodes(isRankCol) {
+				rColType = "col_double()"
+			}
+			types = append(types, rColType)
+		}
+	}
+	for range s.Scoring {
+		types = append(types, "col_double()")
+	}
+	return types
+}
+
+// metadataCols returns the optional response metadata columns to include in output
+func (s *Survey) metadataCols() []metadataCol {
+	if !s.IncludeMetadata {
+		return []metadataCol{}
+	}
+	return s.allMetadataCols()
+}
+
+// allMetadataCols returns every response metadata column, leaving out those that may identify respondents if ExcludePII is set
+func (s *Survey) allMetadataCols() []metadataCol {
+	cols := []metadataCol{}
+	for _, mc := range metadataCols {
+		if mc.pii && s.ExcludePII {
+			continue
+		}
+		cols = append(cols, mc)
 	}
 	return cols
 }
@@ -106,13 +297,20 @@ data <- read_csv(input_path, col_types = cols(
 	duration = col_integer(),
 	recorded = col_datetime(),
 `
+	for _, mc := range s.metadataCols() {
+		scriptImport += fmt.Sprintf("\t%s = %s,\n", mc.name, mc.rColType)
+	}
 
 	choiceScales := make(map[string][]Choice)
+	codeScales := make(map[string][]Choice)
+	labeledCols := []string{}
 	firstLine := true
+	names := s.columnNames()
 	for _, id := range s.QuestionOrder {
 		q := s.Questions[id]
 
-		for _, colID := range q.CSVCols() {
+		for i, colID := range q.CSVCols() {
+			name := names.questions[id][i]
 			rColType, isRankCol := getColType(colID, q)
 			if rColType != "" {
 				if !firstLine {
@@ -120,17 +318,33 @@ data <- read_csv(input_path, col_types = cols(
 				} else {
 					firstLine = false
 				}
-				if rColType == "col_factor()" {
+				if rColType == "col_factor()" && s.NumericCodes && q.hasCodes(isRankCol) {
+					// Read the codes as numbers, then add a labeled factor version of the data
+					labeledCols = append(labeledCols, labeledColWithScales(name, q, choiceScales, codeScales))
+					rColType = "col_double()"
+				} else if rColType == "col_factor()" {
 					rColType = colTypeWithScales(q, isRankCol, choiceScales)
 				}
-				scriptImport += fmt.Sprintf("\t%s = %s", colID, rColType)
+				scriptImport += fmt.Sprintf("\t%s = %s", name, rColType)
 			}
 		}
 	}
+	for _, name := range names.scoring {
+		if !firstLine {
+			scriptImport += ",\n"
+		} else {
+			firstLine = false
+		}
+		scriptImport += fmt.Sprintf("\t%s = col_double()", name)
+	}
 	scriptImport += "\n))\n"
+	if len(labeledCols) > 0 {
+		scriptImport += "data_labeled <- data %>% mutate(\n" + strings.Join(labeledCols, ",\n") + "\n)\n"
+	}
 
 	scriptDefs += addScales(choiceScales)
-	scriptCleanup := addCleanup(choiceScales)
+	scriptDefs += addCodeScales(codeScales)
+	scriptCleanup := addCleanup(choiceScales) + addCodeCleanup(codeScales)
 
 	_, err := w.WriteString(scriptPreamble + "\n" + scriptDefs + "\n" + scriptImport + "\n" + scriptCleanup)
 	if err != nil {
@@ -167,12 +381,32 @@ func getColType(colID string, q *Question) (rColType string, isRankCol bool) {
 	} else {
 		rColType = q.RColType()
 	}
+	if t, ok := q.colTypes[colID]; ok {
+		rColType = t
+	}
 	return
 }
 
 func colTypeWithScales(q *Question, isRankCol bool, choiceScales map[string][]Choice) string {
-	var choices []Choice
-	ordered := false
+	choices, ordered := factorLevels(q, isRankCol)
+	rColType := "col_factor()"
+	if len(choices) > 0 {
+		scaleID := choiceScaleID(choices)
+		if _, ok := choiceScales[scaleID]; !ok {
+			choiceScales[scaleID] = choices
+		}
+		oString := ""
+		if ordered {
+			oString = ", ordered = TRUE"
+		}
+		rColType = "col_factor(levels = " + scaleID + oString + ")"
+	}
+
+	return rColType
+}
+
+// factorLevels returns the levels of a factor column of q, and whether they are ordered
+func factorLevels(q *Question, isRankCol bool) (choices []Choice, ordered bool) {
 	if q.qType == PickGroupRank || q.qType == RankOrder {
 		choices = make([]Choice, 0)
 		if isRankCol {
@@ -192,24 +426,32 @@ func colTypeWithScales(q *Question, isRankCol bool, choiceScales map[string][]Ch
 		ordered = q.OrderedChoices()
 	}
 
-	rColType := "col_factor()"
 	if len(choices) > 0 {
 		if q.qType == PickGroupRank {
 			choices = addNotGroupedOption(choices)
 		}
 		choices = addNoResponseOption(choices)
-		scaleID := choiceScaleID(choices)
-		if _, ok := choiceScales[scaleID]; !ok {
-			choiceScales[scaleID] = choices
-		}
-		oString := ""
-		if ordered {
-			oString = ", ordered = TRUE"
-		}
-		rColType = "col_factor(levels = " + scaleID + oString + ")"
 	}
+	return choices, ordered
+}
 
-	return rColType
+// labeledColWithScales returns an R expression converting the numeric codes in colID to a labeled factor
+func labeledColWithScales(colID string, q *Question, choiceScales map[string][]Choice, codeScales map[string][]Choice) string {
+	choices := addNoResponseOption(q.ResponseChoices())
+	scaleID := choiceScaleID(choices)
+	if _, ok := choiceScales[scaleID]; !ok {
+		choiceScales[scaleID] = choices
+	}
+	// Questions can share labels but not codes, so codes get their own IDs
+	codesID := codeScaleID(choices)
+	if _, ok := codeScales[codesID]; !ok {
+		codeScales[codesID] = choices
+	}
+	oString := ""
+	if q.OrderedChoices() {
+		oString = ", ordered = TRUE"
+	}
+	return fmt.Sprintf("\t%s = factor(%s, levels = %s, labels = %s%s)", colID, colID, codesID, scaleID, oString)
 }
 
 func addNotGroupedOption(choices []Choice) []Choice {
@@ -249,6 +491,14 @@ func choiceScaleID(choices []Choice) string {
 	return fmt.Sprintf("scale_%x", sha1.Sum([]byte(s)))
 }
 
+func codeScaleID(choices []Choice) string {
+	s := ""
+	for _, c := range choices {
+		s += c.code() + ","
+	}
+	return fmt.Sprintf("codes_%x", sha1.Sum([]byte(s)))
+}
+
 func addScales(choiceScales map[string][]Choice) string {
 	scales := []string{}
 	for id, scale := range choiceScales {
@@ -277,6 +527,33 @@ func addScales(choiceScales map[string][]Choice) string {
 	return defs
 }
 
+// addCodeScales returns R definitions of the recode values matching each choice scale
+func addCodeScales(codeScales map[string][]Choice) string {
+	scales := []string{}
+	for id, scale := range codeScales {
+		codes := []string{}
+		for _, c := range scale {
+			codes = append(codes, c.code())
+		}
+		scales = append(scales, fmt.Sprintf("%s <- c(%s)\n", id, strings.Join(codes, ", ")))
+	}
+	sort.Strings(scales)
+	return strings.Join(scales, "")
+}
+
+func addCodeCleanup(codeScales map[string][]Choice) string {
+	scales := []string{}
+	for id := range codeScales {
+		scales = append(scales, id)
+	}
+	sort.Strings(scales)
+	defs := ""
+	for _, s := range scales {
+		defs += fmt.Sprintf("rm(%s)\n", s)
+	}
+	return defs
+}
+
 func addCleanup(choiceScales map[string][]Choice) string {
 	scales := []string{}
 	for id := range choiceScales {
@@ -301,26 +578,130 @@ func (s *Survey) ReadXML(r *bufio.Reader) error {
 	if err != nil {
 		return fmt.Errorf("could not parse xml: %s", err)
 	}
-	responses := []*Response{}
 	root := doc.SelectElement("Responses")
-	for _, resp := range root.SelectElements("Response") {
+	if root == nil {
+		return errors.New("xml had no Responses element")
+	}
+	return s.readResponses(root.SelectElements("Response"))
+}
+
+// ReadCSV reads a Qualtrics CSV file of participant responses. Qualtrics CSV exports have three header rows;
+// the third holds each column's ImportId, which sp uses to match the column to its question.
+// Legacy exports, which lack the ImportIds, can't be read.
+func (s *Survey) ReadCSV(r *bufio.Reader) error {
+	skipBOM(r)
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return fmt.Errorf("could not parse csv: %s", err)
+	}
+	if len(rows) < 3 {
+		return errors.New("csv had fewer than 3 header rows")
+	}
+	keys, err := importIDs(rows[2])
+	if err != nil {
+		return err
+	}
+	elements := []*etree.Element{}
+	for _, row := range rows[3:] {
+		resp := etree.NewElement("Response")
+		for i, v := range row {
+			if v != "" {
+				resp.CreateElement(keys[i]).SetText(v)
+			}
+		}
+		elements = append(elements, resp)
+	}
+	return s.readResponses(elements)
+}
+
+// IsQualtricsCSV returns true if r starts like a Qualtrics CSV export that ReadCSV can read,
+// rather than, for example, a CSV file written by sp
+func IsQualtricsCSV(r *bufio.Reader) bool {
+	skipBOM(r)
+	cr := csv.NewReader(r)
+	var row []string
+	for i := 0; i < 3; i++ {
+		var err error
+		if row, err = cr.Read(); err != nil {
+			return false
+		}
+	}
+	_, err := importIDs(row)
+	return err == nil
+}
+
+// skipBOM skips the byte order mark that starts Qualtrics CSV exports, if r starts with one
+func skipBOM(r *bufio.Reader) {
+	if b, err := r.Peek(3); err == nil && bytes.Equal(b, []byte("\xef\xbb\xbf")) {
+		r.Discard(3)
+	}
+}
+
+// importIDs returns the ImportIds in row, the third header row of a Qualtrics CSV export, such as {"ImportId":"QID1"}
+func importIDs(row []string) ([]string, error) {
+	keys := make([]string, len(row))
+	for i, col := range row {
+		var id struct{ ImportId string }
+		if err := json.Unmarshal([]byte(col), &id); err != nil || id.ImportId == "" {
+			return nil, fmt.Errorf("column %d of the csv has no ImportId; export the responses without the legacy format", i+1)
+		}
+		keys[i] = id.ImportId
+	}
+	return keys, nil
+}
+
+// readResponses replaces s's responses with those in elements, each of which holds one response's answers keyed by ImportId
+func (s *Survey) readResponses(elements []*etree.Element) error {
+	responses := []*Response{}
+	for _, resp := range elements {
 		r := NewResponse()
 		r.ID = getStringElement("_recordId", resp)
 		r.Progress = getIntElement("progress", resp)
 		r.Duration = getIntElement("duration", resp)
 		r.Finished = getBoolElement("finished", resp)
 		r.RecordedOn = getTimeElement("recordedDate", resp)
+		r.StartedOn = getTimeElement("startDate", resp)
+		r.EndedOn = getTimeElement("endDate", resp)
+		r.Status = getStringElement("status", resp)
+		r.IPAddress = getStringElement("ipAddress", resp)
+		r.LocationLatitude = getStringElement("locationLatitude", resp)
+		r.LocationLongitude = getStringElement("locationLongitude", resp)
+		r.DistributionChannel = getStringElement("distributionChannel", resp)
+		r.UserLanguage = getStringElement("userLanguage", resp)
+		r.RecipientLastName = getStringElement("recipientLastName", resp)
+		r.RecipientFirstName = getStringElement("recipientFirstName", resp)
+		r.RecipientEmail = getStringElement("recipientEmail", resp)
+		r.ExternalReference = getStringElement("externalDataReference", resp)
 
 		for _, e := range resp.ChildElements() {
 			r.AddAnswer(e.Tag, e.Text())
 		}
+		s.canonicalizeAnswers(r)
 
 		responses = append(responses, r)
 	}
 	s.Responses = responses
+	if err := s.convertNumericAnswers(); err != nil {
+		return err
+	}
+	s.inferDataTypes()
 	return nil
 }
 
+// inferDataTypes sets the DataType of any embedded data fields that didn't declare one, based on their responses
+func (s *Survey) inferDataTypes() {
+	for _, q := range s.Questions {
+		if q.qType != Embedded || q.dataType != UnknownData {
+			continue
+		}
+		values := []string{}
+		for _, r := range s.Responses {
+			values = append(values, r.answers[q.ID])
+		}
+		q.dataType = inferDataType(values)
+	}
+}
+
 func getStringElement(name string, e *etree.Element) string {
 	var retval string
 	if v := e.SelectElement(name); v != nil {
@@ -375,9 +756,11 @@ func (s *Survey) UnmarshalJSON(b []byte) error {
 		return errors.New("json had no SurveyEntry object")
 	}
 
+	s.ID = qs.SurveyEntry.SurveyID
 	s.Title = qs.SurveyEntry.SurveyName
 	s.Description = qs.SurveyEntry.SurveyDescription
 	s.Status = qs.SurveyEntry.SurveyStatus
+	s.Language = qs.SurveyEntry.SurveyLanguage
 	if t, err := time.Parse(timeFormat, qs.SurveyEntry.SurveyCreationDate); err == nil {
 		s.CreatedOn = t
 	}
@@ -399,6 +782,7 @@ func (s *Survey) UnmarshalJSON(b []byte) error {
 				b := new(block)
 				b.Type = p.Type
 				b.ID = p.ID
+				b.Description = p.Description
 				for _, be := range p.BlockElements {
 					if be.Type == "Question" {
 						b.QuestionIDs = append(b.QuestionIDs, be.QuestionID)
@@ -407,25 +791,14 @@ func (s *Survey) UnmarshalJSON(b []byte) error {
 				s.blocks[b.ID] = b
 			}
 		case "FL":
-			for _, f := range e.flows.Payload.Flow {
-				if f.ID != "" {
-					s.blockOrder = append(s.blockOrder, f.ID)
-				} else if f.Type == "EmbeddedData" {
-					// Treat embedded data as survey questions
-					for _, d := range f.EmbeddedData {
-						q, err := newQuestionFromEmbeddedData(d)
-						if err != nil {
-							return fmt.Errorf("could not create question from JSON: %s", err)
-						}
-						s.Questions[q.ID] = q
-						embeddedDataIDs = append(embeddedDataIDs, q.ID)
-					}
-				} else if f.Type == "BlockRandomizer" {
-					for _, rf := range f.Flow {
-						if rf.ID != "" {
-							s.blockOrder = append(s.blockOrder, rf.ID)
-						}
-					}
+			var err error
+			if embeddedDataIDs, err = s.readFlow(e.flows.Payload.Flow, embeddedDataIDs); err != nil {
+				return err
+			}
+		case "SCO":
+			if e.scoring.Payload != nil {
+				for _, c := range e.scoring.Payload.ScoringCategories {
+					s.Scoring = append(s.Scoring, ScoringCategory{ID: c.ID, Name: c.Name})
 				}
 			}
 		// case "QC":
@@ -456,9 +829,46 @@ func (s *Survey) UnmarshalJSON(b []byte) error {
 	s.addDynamicChoices()
 	s.addEmbeddedData(embeddedDataIDs)
 
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&s.qsfDoc); err != nil {
+		return err
+	}
+	s.original = s.snapshot()
+
 	return nil
 }
 
+// readFlow adds the blocks in flow and its nested flows (e.g., randomizers and branches) to the block order,
+// and adds its embedded data fields to the survey's questions. It returns embeddedDataIDs with the new fields' IDs appended.
+func (s *Survey) readFlow(flow []*qsfSurveyElementFlow, embeddedDataIDs []string) ([]string, error) {
+	for _, f := range flow {
+		if f.ID != "" {
+			s.blockOrder = append(s.blockOrder, f.ID)
+			continue
+		}
+		if f.Type == "EmbeddedData" {
+			// Treat embedded data as survey questions; a field can be set by several elements of the flow
+			for _, d := range f.EmbeddedData {
+				if _, ok := s.Questions[d.Field]; ok {
+					continue
+				}
+				q, err := newQuestionFromEmbeddedData(d)
+				if err != nil {
+					return nil, fmt.Errorf("could not create question from JSON: %s", err)
+				}
+				s.Questions[q.ID] = q
+				embeddedDataIDs = append(embeddedDataIDs, q.ID)
+			}
+		}
+		var err error
+		if embeddedDataIDs, err = s.readFlow(f.Flow, embeddedDataIDs); err != nil {
+			return nil, err
+		}
+	}
+	return embeddedDataIDs, nil
+}
+
 func (s *Survey) emptyTrash() {
 	for _, b := range s.blocks {
 		if b.Type == "Trash" {
@@ -514,6 +924,7 @@ type qsfSurveyEntry struct {
 	SurveyName         string
 	SurveyDescription  string
 	SurveyStatus       string
+	SurveyLanguage     string
 	SurveyStartDate    string
 	SurveyCreationDate string
 	LastModified       string
@@ -527,6 +938,7 @@ type qsfSurveyElement struct {
 	Payload            *qsfPayload
 	blocks             *qsfSurveyElementBlocks
 	flows              *qsfSurveyElementFlows
+	scoring            *qsfSurveyElementScoring
 }
 
 var reElementType = regexp.MustCompile(`"Element"\s*:\s*"(.*?)"`)
@@ -611,6 +1023,15 @@ func (e *qsfSurveyElement) UnmarshalJSON(b []byte) error {
 		}
 		e.Element = fl.Element
 		e.flows = &fl
+	case "SCO":
+		var sco qsfSurveyElementScoring
+		err := json.Unmarshal(b, &sco)
+		if err != nil {
+			log.Printf("b: %s\n", b)
+			return fmt.Errorf("could not parse SCO element: %s", err)
+		}
+		e.Element = sco.Element
+		e.scoring = &sco
 	case "QC":
 		var data struct {
 			Element            string
@@ -638,6 +1059,7 @@ type qsfPayload struct {
 	DataExportTag              string
 	QuestionType               string
 	QuestionDescription        string
+	Configuration              interface{}
 	Selector                   string
 	SubSelector                string
 	QuestionID                 string
@@ -653,6 +1075,22 @@ type qsfPayload struct {
 	HasChoiceDataExportTags    bool
 	MappedChoiceDataExportTags map[int]string
 	Groups                     []string
+	GradingData                json.RawMessage
+	Language                   json.RawMessage
+	NextChoiceId               interface{}
+	NextAnswerId               interface{}
+}
+
+// nextID parses a NextChoiceId or NextAnswerId field, which may be a number or a string; it returns 0 if the field is missing
+func nextID(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(fmt.Sprintf("%v", v))
+	if err != nil {
+		return 0
+	}
+	return n
 }
 
 type qsfDynChoices struct {
@@ -744,6 +1182,9 @@ func (p *qsfPayload) OrderedChoices(choicesAreQuestions bool) ([]Choice, error)
 		}
 
 		c := Choice{ID: s, Label: p.ChoiceMap[i].Display, VarName: varName, HasText: hasText}
+		if !choicesAreQuestions {
+			c.Recode = p.recodeValue(i)
+		}
 		ordered = append(ordered, c)
 	}
 
@@ -767,13 +1208,82 @@ func (p *qsfPayload) OrderedAnswers() ([]Choice, error) {
 			}
 		}
 
-		c := Choice{ID: s.String(), Label: p.Answers[i].Display, VarName: p.VariableNaming[i], HasText: hasText}
+		c := Choice{ID: s.String(), Label: p.Answers[i].Display, VarName: p.VariableNaming[i], HasText: hasText, Recode: p.recodeValue(i)}
 		ordered = append(ordered, c)
 	}
 
 	return ordered, nil
 }
 
+// recodeValue returns the value Qualtrics records for choice i: its recode value if one was set, otherwise its ID
+func (p *qsfPayload) recodeValue(i int) string {
+	if v, ok := p.RecodeValues[i]; ok {
+		return fmt.Sprintf("%v", v)
+	}
+	return strconv.Itoa(i)
+}
+
+// MetaChoices returns the choices of a browser meta info question, ordered by choice ID
+func (p *qsfPayload) MetaChoices() []Choice {
+	m, ok := p.Choices.(map[string]interface{})
+	if !ok {
+		return []Choice{}
+	}
+	ids := []int{}
+	for k := range m {
+		if i, err := strconv.Atoi(k); err == nil {
+			ids = append(ids, i)
+		} else {
+			log.Printf("could not convert '%s' to int: %s", k, err)
+		}
+	}
+	sort.Ints(ids)
+
+	choices := []Choice{}
+	for _, i := range ids {
+		id := strconv.Itoa(i)
+		c := Choice{ID: id}
+		if v, ok := m[id].(map[string]interface{}); ok {
+			if display, ok := v["Display"].(string); ok {
+				c.Label = display
+			}
+		}
+		choices = append(choices, c)
+	}
+	return choices
+}
+
+// Grades returns the points each choice awards per scoring category, keyed by choice ID and then category ID
+func (p *qsfPayload) Grades() map[string]map[string]float64 {
+	grades := make(map[string]map[string]float64)
+	if len(p.GradingData) == 0 {
+		return grades
+	}
+	var data []struct {
+		ChoiceID interface{}
+		Grades   map[string]interface{}
+	}
+	if err := json.Unmarshal(p.GradingData, &data); err != nil {
+		// Questions without scoring sometimes use an empty object instead of an empty array
+		return grades
+	}
+	for _, d := range data {
+		id := fmt.Sprintf("%v", d.ChoiceID)
+		for cat, v := range d.Grades {
+			f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+			if err != nil {
+				log.Printf("could not convert grade '%v' to float: %s", v, err)
+				continue
+			}
+			if grades[id] == nil {
+				grades[id] = make(map[string]float64)
+			}
+			grades[id][cat] = f
+		}
+	}
+	return grades
+}
+
 type qsfChoice struct {
 	Display   string
 	TextEntry string
@@ -792,6 +1302,7 @@ type qsfSurveyElementBlocksMap struct {
 type qsfSurveyElementBlock struct {
 	Type          string
 	ID            string
+	Description   string
 	BlockElements []*qsfPayload
 	Options       *qsfPayloadOptions
 }
@@ -803,6 +1314,7 @@ type qsfPayloadOptions struct {
 type block struct {
 	Type        string
 	ID          string
+	Description string
 	QuestionIDs []string
 }
 
@@ -823,6 +1335,21 @@ type qsfSurveyElementFlow struct {
 	EmbeddedData []*qsfEmbeddedData
 }
 
+type qsfSurveyElementScoring struct {
+	Element string
+	Payload *qsfScoringPayload
+}
+
+type qsfScoringPayload struct {
+	ScoringCategories []*qsfScoringCategory
+}
+
+type qsfScoringCategory struct {
+	ID          string
+	Name        string
+	Description string
+}
+
 type qsfEmbeddedData struct {
 	Type         string
 	Field        string
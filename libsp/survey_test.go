@@ -9,6 +9,8 @@ import (
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/beevik/etree"
 )
 
 func TestWriteCSV(t *testing.T) {
@@ -37,44 +39,46 @@ func TestWriteCSV(t *testing.T) {
 
 	var tests = [][]string{
 		{"id", "finished", "progress", "duration", "recorded",
+			"Q22_browser", "Q22_version", "Q22_os", "Q22_resolution", "Q22_flash", "Q22_user_agent",
 			"Q1Label", "Q18Label", "Q3Label",
 			"Q4Label_1", "Q4Label_2", "Q4Label_3", "Q4Label_5", "Q4Label_5_text", "Q4Label_6", "Q4Label_6_text", "Q4Label_4",
-			"Q19_choice1", "Q19_choice3", "Q19_choice2", "Q19_none", // 19
+			"Q19_choice1", "Q19_choice3", "Q19_choice2", "Q19_none", // 25
 			"Q11Label", "Q11Label_3_text",
 			"Q5Label_statement1", "Q5Label_statement2", "Q5Label_statement3", "Q5Label_other", "Q5Label_other_text",
-			"Q13Label_1_1", "Q13Label_1_2", "Q13Label_1_3", "Q13Label_2_1", "Q13Label_2_2", "Q13Label_2_3", "Q13Label_3_1", "Q13Label_3_2", "Q13Label_3_3", "Q13Label_5_1", "Q13Label_5_2", "Q13Label_5_3", "Q13Label_4_1", "Q13Label_4_2", "Q13Label_4_3", "Q13Label_4_text", // 42
+			"Q13Label_1_1", "Q13Label_1_2", "Q13Label_1_3", "Q13Label_2_1", "Q13Label_2_2", "Q13Label_2_3", "Q13Label_3_1", "Q13Label_3_2", "Q13Label_3_3", "Q13Label_5_1", "Q13Label_5_2", "Q13Label_5_3", "Q13Label_4_1", "Q13Label_4_2", "Q13Label_4_3", "Q13Label_4_text", // 48
 			"Q6Label_1", "Q6Label_2", "Q6Label_3",
 			"Q16_first_click", "Q16_last_click", "Q16_page_submit", "Q16_click_count",
 			"Q7Label_text", "Q8Label_text",
 			"Q9Label_1", "Q9Label_2", "Q9Label_3",
 			"Q10Label_1", "Q10Label_2", "Q10Label_3",
-			"pgr_item.1_GROUP", "pgr_item.1_RANK", "pgr_item.2_GROUP", "pgr_item.2_RANK", "pgr_item.3_GROUP", "pgr_item.3_RANK", "pgr_item.4_GROUP", "pgr_item.4_RANK", "pgr_other_GROUP", "pgr_other_RANK", "pgr_other_text", // 68
+			"pgr_item.1_GROUP", "pgr_item.1_RANK", "pgr_item.2_GROUP", "pgr_item.2_RANK", "pgr_item.3_GROUP", "pgr_item.3_RANK", "pgr_item.4_GROUP", "pgr_item.4_RANK", "pgr_other_GROUP", "pgr_other_RANK", "pgr_other_text", // 74
 			"Q15Label", "Q15Label_group",
 			"Q29_choice1", "Q29_choice2", "Q29_choice3_w_txt", "Q29_choice3_w_txt_text", "Q29_choice5",
 			"Q20", "Q21",
-			"Q28_statement1", "Q28_statement2", "Q28_statement3", "Q28_other", "Q28_other_text", // 82
+			"Q28_statement1", "Q28_statement2", "Q28_statement3", "Q28_other", "Q28_other_text", // 88
 			"Q23_1", "Q23_2", "Q23_3", "Q23_4", "Q23_4_text",
 			"Q26", "Q27",
 			"loop.base_1", "loop.base_2", "loop.base_3",
 			"Q31", "Q32_1", "Q32_2", "Q32_3", "Q33_text",
 			"s"},
 		{"R_1dtWhiBDD96nfyk", "true", "100", "122", "2019-08-20 12:44:31",
+			"", "", "", "", "", "",
 			"Click to write Choice 1", "", "Click to write Choice 2",
 			"FALSE", "FALSE", "TRUE", "TRUE", "other response 1", "TRUE", "other response 2", "FALSE",
-			"FALSE", "TRUE", "FALSE", "FALSE", // 19
+			"FALSE", "TRUE", "FALSE", "FALSE", // 25
 			"Click to write Choice 2 (ordered 1st)", "",
 			"scale1", "scale2", "scale3", "scale3", "other matrix row",
-			"TRUE", "TRUE", "FALSE", "FALSE", "TRUE", "TRUE", "FALSE", "TRUE", "FALSE", "FALSE", "TRUE", "FALSE", "FALSE", "FALSE", "TRUE", "other matrix multiple row", // 42
+			"TRUE", "TRUE", "FALSE", "FALSE", "TRUE", "TRUE", "FALSE", "TRUE", "FALSE", "FALSE", "TRUE", "FALSE", "FALSE", "FALSE", "TRUE", "other matrix multiple row", // 48
 			"Click to write Scale point 1", "No response", "Click to write Scale point 2",
 			"1.313", "32.89", "33.84", "15",
 			"one line of text", "multiple\nlines\nof\ntext?",
 			"field 1", "field 2", "field 3",
 			"3", "2", "1",
-			"Group 1", "3", "Group 2", "1", "Group 1", "2", "Group 1", "1", "Group 3", "1", "in group 3", // 68
+			"Group 1", "3", "Group 2", "1", "Group 1", "2", "Group 1", "1", "Group 3", "1", "in group 3", // 74
 			"6", "Detractor",
 			"1", "2", "3", "testing", "4",
 			"", "",
-			"Click to write Scale Point 1", "Click to write Scale Point 2", "Click to write Scale Point 3", "Click to write Scale Point 1", "", // 82
+			"Click to write Scale Point 1", "Click to write Scale Point 2", "Click to write Scale Point 3", "Click to write Scale Point 1", "", // 88
 			"", "", "", "", "",
 			"", "",
 			"", "", "",
@@ -82,22 +86,23 @@ func TestWriteCSV(t *testing.T) {
 			"g",
 		},
 		{"R_z72KJQMnr3lxZGp", "true", "100", "104", "2019-08-20 12:46:35",
+			"", "", "", "", "", "",
 			"Click to write Choice 3", "", "Click to write Choice 2",
 			"FALSE", "FALSE", "FALSE", "FALSE", "", "FALSE", "", "TRUE",
-			"FALSE", "FALSE", "FALSE", "TRUE", // 19
+			"FALSE", "FALSE", "FALSE", "TRUE", // 25
 			"Click to write Choice 3", "other text",
 			"scale3", "scale2", "", "", "",
-			"TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "TRUE", "TRUE", "TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "", // 42
+			"TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "TRUE", "TRUE", "TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "", // 48
 			"", "Click to write Scale point 2", "Click to write Scale point 1",
 			"3.172", "25.605", "26.387", "9",
 			"foo", "bar",
 			"name", "email", "job role",
 			"1", "2", "3",
-			"Group 1", "2", "Group 1", "1", "Group 2", "2", "Group 2", "1", "Not grouped", "Not grouped", "Not grouped", // 68
+			"Group 1", "2", "Group 1", "1", "Group 2", "2", "Group 2", "1", "Not grouped", "Not grouped", "Not grouped", // 74
 			"10", "Promoter",
 			"", "", "", "", "",
 			"", "",
-			"", "", "", "", "", // 82
+			"", "", "", "", "", // 88
 			"", "", "", "", "",
 			"", "",
 			"", "", "",
@@ -105,16 +110,17 @@ func TestWriteCSV(t *testing.T) {
 			"e",
 		},
 		{"R_3MPTb9vwnCBmijR", "false", "33", "22", "2019-08-20 12:52:35",
+			"", "", "", "", "", "",
 			"Click to write Choice 2", "", "Click to write Choice 2",
 			"FALSE", "TRUE", "FALSE", "FALSE", "", "FALSE", "", "FALSE",
-			"TRUE", "FALSE", "TRUE", "FALSE", // 19
+			"TRUE", "FALSE", "TRUE", "FALSE", // 25
 			"", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "", "",
 			"", "", "", "",
 			"", "", "", "", "", "", "", "", "", "", "",
 			"", "", "", "",
 			"", "", "", "", "",
 			"", "",
-			"", "", "", "", "", // 82
+			"", "", "", "", "", // 88
 			"", "", "", "", "",
 			"", "",
 			"", "", "",
@@ -122,25 +128,26 @@ func TestWriteCSV(t *testing.T) {
 			"",
 		},
 		{"R_2EzY1K5pqRpzi0n", "true", "100", "140", "2020-11-09 13:12:11",
+			"Chrome", "86.0.4240.183", "Macintosh", "2560x1440", "", "",
 			"Click to write Choice 1", "choice3", "Click to write Choice 3",
 			"TRUE", "FALSE", "TRUE", "FALSE", "", "TRUE", "other 2 text", "FALSE",
-			"TRUE", "FALSE", "TRUE", "FALSE", // 19
+			"TRUE", "FALSE", "TRUE", "FALSE", // 25
 			"Click to write Choice 3", "other text",
 			"scale1", "scale2", "scale3", "No response", "",
-			"TRUE", "TRUE", "FALSE", "TRUE", "FALSE", "TRUE", "FALSE", "TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "", // 42
+			"TRUE", "TRUE", "FALSE", "TRUE", "FALSE", "TRUE", "FALSE", "TRUE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "FALSE", "", // 48
 			"Click to write Scale point 1", "Click to write Scale point 2", "No response",
 			"1.717", "15.783", "16.628", "10",
-			"line of text", "", // 51
+			"line of text", "", // 57
 			"form 1", "form 2", "form 3",
 			"3", "2", "1",
-			"Group 1", "1", "Group 2", "1", "Group 3", "1", "Not grouped", "Not grouped", "Not grouped", "Not grouped", "", // 68
+			"Group 1", "1", "Group 2", "1", "Group 3", "1", "Not grouped", "Not grouped", "Not grouped", "Not grouped", "", // 74
 			"5", "Detractor",
 			"1", "2", "3", "", "",
 			"Dyna choice 2", "Dyna choice 2",
-			"Click to write Scale Point 1", "Click to write Scale Point 2", "Click to write Scale Point 3", "Click to write Scale Point 1", "other text", // 82
+			"Click to write Scale Point 1", "Click to write Scale Point 2", "Click to write Scale Point 3", "Click to write Scale Point 1", "other text", // 88
 			"10", "20", "30", "0", "",
 			"", "Click to write Choice 2",
-			"TRUE", "TRUE", "TRUE", // 92
+			"TRUE", "TRUE", "TRUE", // 98
 			"Click to write Choice 1", "TRUE", "TRUE", "FALSE", "choice 3 text",
 			"",
 		},
@@ -224,6 +231,12 @@ func TestWriteR(t *testing.T) {
 		"progress = col_integer(),",
 		"duration = col_integer(),",
 		"recorded = col_datetime(),",
+		"Q22_browser = col_character(),",
+		"Q22_version = col_character(),",
+		"Q22_os = col_character(),",
+		"Q22_resolution = col_character(),",
+		"Q22_flash = col_character(),",
+		"Q22_user_agent = col_character(),",
 		"Q1Label = col_factor(levels = scale_0d33bdb7dd7ad7e7644895dab595541b141f5b39),",
 		"Q18Label = col_factor(levels = scale_8a3feac0fed5c3348d223a4c4a52d9b74e347e0a),",
 		"Q3Label = col_factor(levels = scale_0d33bdb7dd7ad7e7644895dab595541b141f5b39),",
@@ -305,7 +318,7 @@ func TestWriteR(t *testing.T) {
 		"Q32_1 = col_logical(),",
 		"Q32_2 = col_logical(),",
 		"Q32_3 = col_logical(),",
-		"s = col_factor()",
+		"s = col_character()",
 		"))",
 		"",
 		"rm(input_path)",
@@ -405,4 +418,356 @@ func TestReadXML(t *testing.T) {
 	}
 }
 
+func TestReadXMLMetadata(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(qsfTestContent))
+	s, err := ReadQsf(reader)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	}
+	if s == nil {
+		t.Error("s = nil")
+		return
+	}
+	reader = bufio.NewReader(strings.NewReader(xmlTestContent))
+	if err = s.ReadXML(reader); err != nil {
+		t.Errorf("err = %s", err)
+	}
+
+	r := s.Responses[0]
+	if r.StartedOn.String() != "2019-08-20 12:42:28 +0000 UTC" {
+		t.Errorf("StartedOn = '%s'; want '2019-08-20 12:42:28 +0000 UTC'", r.StartedOn)
+	}
+	if r.EndedOn.String() != "2019-08-20 12:44:31 +0000 UTC" {
+		t.Errorf("EndedOn = '%s'; want '2019-08-20 12:44:31 +0000 UTC'", r.EndedOn)
+	}
+	if r.Status != "IP Address" {
+		t.Errorf("Status = '%s'; want 'IP Address'", r.Status)
+	}
+	if r.DistributionChannel != "anonymous" {
+		t.Errorf("DistributionChannel = '%s'; want 'anonymous'", r.DistributionChannel)
+	}
+	if r.UserLanguage != "EN" {
+		t.Errorf("UserLanguage = '%s'; want 'EN'", r.UserLanguage)
+	}
+	if r.IPAddress != "*******" {
+		t.Errorf("IPAddress = '%s'; want '*******'", r.IPAddress)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	fromXML, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = fromXML.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	fromCSV, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	export := "\xef\xbb\xbf" + qualtricsCSV(t, xmlTestContent)
+	if !IsQualtricsCSV(bufio.NewReader(strings.NewReader(export))) {
+		t.Errorf("IsQualtricsCSV() = false; want true")
+	}
+	if err = fromCSV.ReadCSV(bufio.NewReader(strings.NewReader(export))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	var want, got bytes.Buffer
+	fromXML.WriteCSV(bufio.NewWriter(&want))
+	fromCSV.WriteCSV(bufio.NewWriter(&got))
+	if got.String() != want.String() {
+		t.Errorf("WriteCSV() after ReadCSV() = \n%s\nwant\n%s", got.String(), want.String())
+	}
+	if len(fromCSV.Responses) != 4 || fromCSV.Responses[0].StartedOn != fromXML.Responses[0].StartedOn {
+		t.Errorf("ReadCSV() read %d responses, starting on %s; want 4, starting on %s", len(fromCSV.Responses), fromCSV.Responses[0].StartedOn, fromXML.Responses[0].StartedOn)
+	}
+
+	// sp's own CSV output isn't a Qualtrics export
+	if IsQualtricsCSV(bufio.NewReader(strings.NewReader(want.String()))) {
+		t.Errorf("IsQualtricsCSV() of sp's output = true; want false")
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"too few header rows", "Q1,Q2\nQuestion 1,Question 2\n"},
+		{"legacy format", "V1,Q1\nResponseID,Question 1\nR_1,Yes\n"},
+		{"missing ImportId", "ResponseId,Q1\nResponse ID,Question 1\n\"{\"\"ImportId\"\":\"\"_recordId\"\"}\",\"{}\"\nR_1,Yes\n"},
+		{"unterminated quote", "\"Q1\n"},
+	}
+	for _, test := range tests {
+		s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		if err = s.ReadCSV(bufio.NewReader(strings.NewReader(test.content))); err == nil {
+			t.Errorf("%s: ReadCSV() err = nil; want an error", test.name)
+		}
+		if IsQualtricsCSV(bufio.NewReader(strings.NewReader(test.content))) {
+			t.Errorf("%s: IsQualtricsCSV() = true; want false", test.name)
+		}
+	}
+}
+
+// qualtricsCSV returns the responses in the XML export content as a Qualtrics CSV export, with the ImportId of each
+// column in its third header row
+func qualtricsCSV(t *testing.T, content string) string {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(content); err != nil {
+		t.Fatalf("err = %s", err)
+	}
+	responses := doc.SelectElement("Responses").SelectElements("Response")
+	cols := []string{}
+	for _, r := range responses {
+		for _, e := range r.ChildElements() {
+			if !contains(cols, e.Tag) {
+				cols = append(cols, e.Tag)
+			}
+		}
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	importIDs := []string{}
+	for _, c := range cols {
+		importIDs = append(importIDs, `{"ImportId":"`+c+`"}`)
+	}
+	w.Write(cols)
+	w.Write(cols)
+	w.Write(importIDs)
+	for _, r := range responses {
+		row := []string{}
+		for _, c := range cols {
+			row = append(row, getStringElement(c, r))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return b.String()
+}
+
+func TestMetadataCSVCols(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(qsfTestContent))
+	s, err := ReadQsf(reader)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	}
+	if s == nil {
+		t.Error("s = nil")
+		return
+	}
+
+	tests := []struct {
+		includeMetadata bool
+		excludePII      bool
+		want            []string
+	}{
+		{false, false, []string{"id", "finished", "progress", "duration", "recorded", "Q22_browser"}},
+		{true, false, []string{"id", "finished", "progress", "duration", "recorded", "start", "end", "status", "ip_address", "latitude", "longitude", "channel", "language", "recipient_last_name", "recipient_first_name", "recipient_email", "external_reference", "Q22_browser"}},
+		{true, true, []string{"id", "finished", "progress", "duration", "recorded", "start", "end", "status", "channel", "language", "Q22_browser"}},
+	}
+	for _, test := range tests {
+		s.IncludeMetadata = test.includeMetadata
+		s.ExcludePII = test.excludePII
+		cols := s.csvCols()
+		for i, want := range test.want {
+			if cols[i] != want {
+				t.Errorf("IncludeMetadata = %t, ExcludePII = %t: cols[%d] = '%s'; want '%s'", test.includeMetadata, test.excludePII, i, cols[i], want)
+			}
+		}
+	}
+}
+
+func TestWriteCSVNumericCodes(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(qsfTestContent))
+	s, err := ReadQsf(reader)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	}
+	if s == nil {
+		t.Error("s = nil")
+		return
+	}
+	reader = bufio.NewReader(strings.NewReader(xmlTestContent))
+	if err = s.ReadXML(reader); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	s.NumericCodes = true
+
+	var b bytes.Buffer
+	if err = s.WriteCSV(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	cols := make(map[string]int)
+	for i, c := range records[0] {
+		cols[c] = i
+	}
+
+	tests := []struct {
+		row  int
+		col  string
+		want string
+	}{
+		{1, "Q1Label", "1"},
+		{1, "Q18Label", ""},
+		{1, "Q4Label_3", "TRUE"},
+		{1, "Q11Label", "2"},
+		{1, "Q5Label_statement1", "1"},
+		{1, "Q5Label_other", "3"},
+		{1, "pgr_item.1_GROUP", "Group 1"},
+		{4, "Q18Label", "3"},
+		{4, "Q5Label_other", "-99"},
+		{4, "Q21", "2"},
+	}
+	for _, test := range tests {
+		if got := records[test.row][cols[test.col]]; got != test.want {
+			t.Errorf("row %d, %s = '%s'; want '%s'", test.row, test.col, got, test.want)
+		}
+	}
+}
+
+func TestWriteRNumericCodes(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(qsfTestContent))
+	s, err := ReadQsf(reader)
+	if err != nil {
+		t.Errorf("err = %s", err)
+	}
+	if s == nil {
+		t.Error("s = nil")
+		return
+	}
+	s.NumericCodes = true
+
+	var b bytes.Buffer
+	if err = s.WriteR(bufio.NewWriter(&b), "test.csv"); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	script := b.String()
+	tests := []string{
+		`codes_a716d020cf0fbb2b2e42db9856793481f7f3c4fd <- c(1, 2, 3, 4, -99)`,
+		`codes_4bbe6b61213c50c997110b13e91c80036c61ee93 <- c(2, 3, 1, -99)`,
+		"\tQ5Label_statement1 = col_double(),",
+		"data_labeled <- data %>% mutate(",
+		"\tQ5Label_statement1 = factor(Q5Label_statement1, levels = codes_a716d020cf0fbb2b2e42db9856793481f7f3c4fd, labels = scale_9bc0385ea2c175f3341306637ae392b35bd86573, ordered = TRUE),",
+		"\tpgr_item.1_GROUP = col_factor(levels = scale_dfbadf501868c43fd508372a48f65f9327d3c676),",
+		"rm(codes_a716d020cf0fbb2b2e42db9856793481f7f3c4fd)",
+	}
+	for _, test := range tests {
+		if !strings.Contains(script, test+"\n") {
+			t.Errorf("script is missing line '%s'", test)
+		}
+	}
+}
+
+func TestColumnNames(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.IncludeMetadata = true
+	s.Questions["QID3"].label = "Q1Label" // collides with QID1
+	s.Questions["QID7"].label = "id"      // Q7's column is id_text, which doesn't collide
+	s.Questions["QID8"].label = "2nd"     // starts with a digit
+	s.Questions["QID19"].choices[1].VarName = "choice1"
+	if _, err = s.AddEmbeddedData("if", TextData); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.AddEmbeddedData("status", TextData); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"QID1", []string{"Q1Label"}},
+		{"QID3", []string{"Q1Label.1"}},
+		{"QID7", []string{"id_text"}},
+		{"QID8", []string{"X2nd_text"}},
+		{"QID19", []string{"Q19_choice1", "Q19_choice1.1", "Q19_choice2", "Q19_none"}},
+		{"if", []string{"if."}},
+		{"status", []string{"status.1"}},
+	}
+	names := s.ColumnNames()
+	for _, test := range tests {
+		if !equalStrings(names[test.id], test.want) {
+			t.Errorf("ColumnNames()[%s] = %v; want %v", test.id, names[test.id], test.want)
+		}
+	}
+
+	cols := s.csvCols()
+	seen := make(map[string]bool)
+	for _, col := range cols {
+		if seen[col] {
+			t.Errorf("csvCols() has duplicate column '%s'", col)
+		}
+		seen[col] = true
+	}
+	if len(s.RenamedColumns()) != 5 {
+		t.Errorf("len(RenamedColumns()) = %d; want 5", len(s.RenamedColumns()))
+		for _, r := range s.RenamedColumns() {
+			t.Logf("%s", r)
+		}
+	}
+
+	var b bytes.Buffer
+	if err = s.WriteR(bufio.NewWriter(&b), "test.csv"); err != nil {
+		t.Errorf("err = %s", err)
+	}
+	for _, line := range []string{"\tQ1Label.1 = col_factor(", "\tif. = col_character()"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("R script is missing '%s'", line)
+		}
+	}
+}
+
+func TestColumnNamesMetadata(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeMetadata bool
+		excludePII      bool
+		want            []string // the names of the status and ip_address fields
+	}{
+		{"no metadata", false, false, []string{"status", "ip_address"}},
+		{"metadata", true, false, []string{"status.1", "ip_address.1"}},
+		{"metadata without PII", true, true, []string{"status.1", "ip_address"}},
+	}
+	for _, test := range tests {
+		s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+		if err != nil {
+			t.Errorf("err = %s", err)
+			return
+		}
+		s.IncludeMetadata = test.includeMetadata
+		s.ExcludePII = test.excludePII
+		for _, field := range []string{"status", "ip_address"} {
+			if _, err = s.AddEmbeddedData(field, TextData); err != nil {
+				t.Errorf("err = %s", err)
+				return
+			}
+		}
+		names := s.ColumnNames()
+		if got := []string{names["status"][0], names["ip_address"][0]}; !equalStrings(got, test.want) {
+			t.Errorf("%s: ColumnNames() = %v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
 // spell-checker: enable
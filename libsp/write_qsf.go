@@ -0,0 +1,616 @@
+package libsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// qsfObject is a generic JSON object from a QSF file; decoding into it preserves fields sp doesn't model
+type qsfObject = map[string]interface{}
+
+// surveySnapshot records the parts of a Survey that WriteQsf can change, as they were read from the QSF
+type surveySnapshot struct {
+	title       string
+	description string
+	blockOrder  []string
+	blocks      map[string][]string
+	questions   map[string]questionSnapshot
+}
+
+type questionSnapshot struct {
+	wording      string
+	exportTag    string
+	choices      []Choice
+	subQuestions []Choice
+}
+
+// ExportTag returns the question's data export tag (e.g., "Q1")
+func (q *Question) ExportTag() string {
+	return q.dataExportTag
+}
+
+// SetExportTag changes the question's data export tag
+func (q *Question) SetExportTag(tag string) {
+	q.dataExportTag = tag
+}
+
+// AddChoice appends a new response choice with the given label.
+// Like Qualtrics, it uses the question's next choice ID rather than reusing the ID of a deleted choice,
+// so responses recorded with that choice aren't attributed to the new one.
+// Its recode value is one more than the highest recode value of the question's choices.
+// For matrix questions, the choice is added to the answer scale rather than the subquestions.
+func (q *Question) AddChoice(label string) (Choice, error) {
+	if q.dynChoices != nil {
+		return Choice{}, fmt.Errorf("question %s uses dynamic choices", q.ID)
+	}
+	next := &q.nextChoiceID
+	switch q.qType {
+	case MultipleChoiceSingleResponse, MultipleChoiceMultiResponse, RankOrder, PickGroupRank:
+	case MatrixSingleResponse, MatrixMultiResponse:
+		next = &q.nextAnswerID
+	default:
+		return Choice{}, fmt.Errorf("cannot add choices to %s question %s", q.qType, q.ID)
+	}
+
+	id := *next
+	for _, c := range q.choices {
+		if n, err := strconv.Atoi(c.ID); err == nil && n >= id {
+			id = n + 1
+		}
+	}
+	if id < 1 {
+		id = 1
+	}
+	*next = id + 1
+	// Recode values are chosen by the survey's author, so they needn't follow the IDs
+	recode := 1
+	for _, c := range q.choices {
+		if n, err := strconv.Atoi(c.Recode); err == nil && n >= recode {
+			recode = n + 1
+		}
+	}
+	c := Choice{ID: strconv.Itoa(id), Label: label, Recode: strconv.Itoa(recode)}
+	q.choices = append(q.choices, c)
+	return c, nil
+}
+
+// BlockOrder returns the IDs of the survey's blocks, in the order they appear in the survey flow
+func (s *Survey) BlockOrder() []string {
+	return append([]string{}, s.blockOrder...)
+}
+
+// SetBlockOrder changes the order of the survey's blocks. ids must hold the same IDs as BlockOrder().
+// Blocks inside a randomizer can only be reordered relative to the other blocks in that randomizer.
+func (s *Survey) SetBlockOrder(ids []string) error {
+	if len(ids) != len(s.blockOrder) {
+		return fmt.Errorf("expected %d block IDs, found %d", len(s.blockOrder), len(ids))
+	}
+	found := make(map[string]int)
+	for _, id := range s.blockOrder {
+		found[id]++
+	}
+	for _, id := range ids {
+		if found[id] == 0 {
+			return fmt.Errorf("unknown or repeated block ID '%s'", id)
+		}
+		found[id]--
+	}
+	embeddedDataIDs := s.embeddedDataIDs()
+	s.blockOrder = append([]string{}, ids...)
+	s.sortQuestions()
+	s.addEmbeddedData(embeddedDataIDs)
+	return nil
+}
+
+// embeddedDataIDs returns the IDs of embedded data fields, in survey order
+func (s *Survey) embeddedDataIDs() []string {
+	ids := []string{}
+	for _, id := range s.QuestionOrder {
+		if s.Questions[id].qType == Embedded {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// copyQsfValue returns a deep copy of v, a value decoded from a QSF document
+func copyQsfValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case qsfObject:
+		copied := make(qsfObject, len(v))
+		for k, e := range v {
+			copied[k] = copyQsfValue(e)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, e := range v {
+			copied[i] = copyQsfValue(e)
+		}
+		return copied
+	}
+	return v
+}
+
+// snapshot records the current state of everything WriteQsf can change
+func (s *Survey) snapshot() *surveySnapshot {
+	snap := &surveySnapshot{
+		title:       s.Title,
+		description: s.Description,
+		blockOrder:  append([]string{}, s.blockOrder...),
+		blocks:      make(map[string][]string),
+		questions:   make(map[string]questionSnapshot),
+	}
+	for id, b := range s.blocks {
+		snap.blocks[id] = append([]string{}, b.QuestionIDs...)
+	}
+	for id, q := range s.Questions {
+		snap.questions[id] = questionSnapshot{
+			wording:      q.Wording,
+			exportTag:    q.dataExportTag,
+			choices:      append([]Choice{}, q.choices...),
+			subQuestions: append([]Choice{}, q.subQuestions...),
+		}
+	}
+	return snap
+}
+
+// WriteQsf saves the survey as a Qualtrics survey definition file (.qsf) that can be imported into Qualtrics.
+// The survey must have been read with ReadQsf; fields sp doesn't model are written unchanged,
+// while changes made through the API (title, description, question wording, export tags, choices, and block order) are applied.
+func (s *Survey) WriteQsf(bw *bufio.Writer) error {
+	if bw == nil {
+		return errors.New("bw cannot be nil")
+	}
+	if s.qsfDoc == nil || s.original == nil {
+		return errors.New("survey was not read from a QSF file")
+	}
+
+	if entry, ok := s.qsfDoc["SurveyEntry"].(qsfObject); ok {
+		if s.Title != s.original.title {
+			entry["SurveyName"] = s.Title
+		}
+		if s.Description != s.original.description {
+			entry["SurveyDescription"] = s.Description
+		}
+	}
+	if err := s.addNewElements(); err != nil {
+		return err
+	}
+	elements, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	for _, e := range elements {
+		element, ok := e.(qsfObject)
+		if !ok {
+			continue
+		}
+		var err error
+		switch element["Element"] {
+		case "SQ":
+			err = s.patchQuestionElement(element)
+		case "BL":
+			s.patchBlockElement(element)
+		case "FL":
+			if payload, ok := element["Payload"].(qsfObject); ok && !equalStrings(s.blockOrder, s.original.blockOrder) {
+				reorderFlow(payload, s.blockOrder)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The document now matches the survey, so later writes only need to apply later changes
+	s.original = s.snapshot()
+
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s.qsfDoc); err != nil {
+		return fmt.Errorf("could not encode QSF: %s", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not flush QSF Writer: %s", err)
+	}
+	return nil
+}
+
+// addNewElements adds blocks, questions, and embedded data fields that aren't in the QSF document yet
+func (s *Survey) addNewElements() error {
+	elements, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	var blocks, flow, count qsfObject
+	for _, e := range elements {
+		element, ok := e.(qsfObject)
+		if !ok {
+			continue
+		}
+		switch element["Element"] {
+		case "BL":
+			blocks = element
+		case "FL":
+			flow, _ = element["Payload"].(qsfObject)
+		case "QC":
+			count = element
+		}
+	}
+
+	nAdded := 0
+	for _, id := range s.QuestionOrder {
+		q := s.Questions[id]
+		if _, ok := s.original.questions[id]; ok {
+			continue
+		}
+		if q.qType == Embedded {
+			if flow == nil {
+				return errors.New("QSF has no survey flow")
+			}
+			addEmbeddedDataToFlow(flow, q)
+			continue
+		}
+		element, err := q.qsfElement(s.ID)
+		if err != nil {
+			return err
+		}
+		elements = append(elements, element)
+		nAdded++
+	}
+	s.qsfDoc["SurveyElements"] = elements
+	// Qualtrics' count includes questions in the trash, so add to it rather than recounting
+	if count != nil && nAdded > 0 {
+		n, _ := strconv.Atoi(fmt.Sprintf("%v", count["SecondaryAttribute"]))
+		count["SecondaryAttribute"] = strconv.Itoa(n + nAdded)
+	}
+
+	for _, id := range s.blockOrder {
+		if _, ok := s.original.blocks[id]; ok {
+			continue
+		}
+		if blocks == nil || flow == nil {
+			return errors.New("QSF has no survey blocks or flow")
+		}
+		b := s.blocks[id]
+		payload := qsfObject{"Type": b.Type, "Description": b.Description, "ID": b.ID, "BlockElements": []interface{}{}}
+		switch p := blocks["Payload"].(type) {
+		case []interface{}:
+			blocks["Payload"] = append(p, payload)
+		case qsfObject:
+			p[strconv.Itoa(len(p))] = payload
+		default:
+			blocks["Payload"] = []interface{}{payload}
+		}
+		// Blocks moved into a randomizer or branch are already in the flow
+		if !flowHasBlock(flow, b.ID) {
+			addToFlow(flow, blockFlowEntry(b, ""), false)
+		}
+	}
+	return nil
+}
+
+// flow returns the payload of the survey flow element in the QSF document
+func (s *Survey) flow() (qsfObject, error) {
+	elements, _ := s.qsfDoc["SurveyElements"].([]interface{})
+	for _, e := range elements {
+		if element, ok := e.(qsfObject); ok && element["Element"] == "FL" {
+			if payload, ok := element["Payload"].(qsfObject); ok {
+				return payload, nil
+			}
+		}
+	}
+	return nil, errors.New("QSF has no survey flow")
+}
+
+// addBlocksToFlow adds the blocks that WriteQsf hasn't added to the survey flow yet to the end of flow,
+// so that elements added after them come later in the flow
+func (s *Survey) addBlocksToFlow(flow qsfObject) {
+	for _, id := range s.blockOrder {
+		if b := s.blocks[id]; b.Type != "Trash" && !flowHasBlock(flow, id) {
+			addToFlow(flow, blockFlowEntry(b, ""), false)
+		}
+	}
+}
+
+// blockFlowEntry returns a survey flow entry showing block b, with the given FlowID
+func blockFlowEntry(b *block, flowID string) qsfObject {
+	flowType := "Standard"
+	if b.Type == "Default" {
+		flowType = "Block"
+	}
+	return qsfObject{"Type": flowType, "ID": b.ID, "FlowID": flowID, "Autofill": []interface{}{}}
+}
+
+// flowHasBlock returns true if flow or one of its nested flows shows the block with ID blockID
+func flowHasBlock(flow qsfObject, blockID string) bool {
+	children, _ := flow["Flow"].([]interface{})
+	for _, c := range children {
+		if child, ok := c.(qsfObject); ok && (child["ID"] == blockID || flowHasBlock(child, blockID)) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFromFlow removes the entry showing the block with ID blockID from flow or its nested flows, and returns it.
+// It returns nil if the block isn't in the flow.
+func removeFromFlow(flow qsfObject, blockID string) qsfObject {
+	children, _ := flow["Flow"].([]interface{})
+	for i, c := range children {
+		child, ok := c.(qsfObject)
+		if !ok {
+			continue
+		}
+		if child["ID"] == blockID {
+			flow["Flow"] = append(children[:i:i], children[i+1:]...)
+			return child
+		}
+		if removed := removeFromFlow(child, blockID); removed != nil {
+			return removed
+		}
+	}
+	return nil
+}
+
+// addToFlow adds entry to the start or end of the top level of flow, with a new FlowID
+func addToFlow(flow qsfObject, entry qsfObject, atStart bool) {
+	// entry's nested flows may already have new FlowIDs
+	n := maxFlowID(flow)
+	if m := maxFlowID(entry); m > n {
+		n = m
+	}
+	n++
+	entry["FlowID"] = fmt.Sprintf("FL_%d", n)
+	children, _ := flow["Flow"].([]interface{})
+	if atStart {
+		children = append([]interface{}{entry}, children...)
+	} else {
+		children = append(children, entry)
+	}
+	flow["Flow"] = children
+	if props, ok := flow["Properties"].(qsfObject); ok {
+		props["Count"] = n
+	}
+}
+
+// addEmbeddedDataToFlow adds the embedded data field q to the first embedded data element at the top level of flow
+// that only declares fields, rather than setting their values
+func addEmbeddedDataToFlow(flow qsfObject, q *Question) {
+	field := qsfObject{"Description": q.ID, "Type": "Recipient", "Field": q.ID, "VariableType": q.dataType.qsfVariableType(), "DataVisibility": []interface{}{}, "AnalyzeText": false}
+	children, _ := flow["Flow"].([]interface{})
+	for _, c := range children {
+		if child, ok := c.(qsfObject); ok && child["Type"] == "EmbeddedData" && !setsEmbeddedData(child) {
+			data, _ := child["EmbeddedData"].([]interface{})
+			child["EmbeddedData"] = append(data, field)
+			return
+		}
+	}
+	addToFlow(flow, qsfObject{"Type": "EmbeddedData", "EmbeddedData": []interface{}{field}}, true)
+}
+
+// setsEmbeddedData returns true if the embedded data flow element sets the value of any of its fields
+func setsEmbeddedData(element qsfObject) bool {
+	data, _ := element["EmbeddedData"].([]interface{})
+	for _, d := range data {
+		if field, ok := d.(qsfObject); ok && field["Type"] == "Custom" {
+			return true
+		}
+	}
+	return false
+}
+
+// maxFlowID returns the highest n among the FL_n flow IDs in flow and its nested flows
+func maxFlowID(flow qsfObject) int {
+	max := 0
+	if id, ok := flow["FlowID"].(string); ok && strings.HasPrefix(id, "FL_") {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, "FL_")); err == nil {
+			max = n
+		}
+	}
+	children, _ := flow["Flow"].([]interface{})
+	for _, c := range children {
+		if child, ok := c.(qsfObject); ok {
+			if n := maxFlowID(child); n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+func (s *Survey) patchQuestionElement(element qsfObject) error {
+	payload, ok := element["Payload"].(qsfObject)
+	if !ok {
+		return nil
+	}
+	id, _ := payload["QuestionID"].(string)
+	q, ok := s.Questions[id]
+	orig, hasOrig := s.original.questions[id]
+	if !ok || !hasOrig {
+		return nil
+	}
+
+	if q.Wording != orig.wording {
+		payload["QuestionText"] = q.Wording
+	}
+	if q.dataExportTag != orig.exportTag {
+		payload["DataExportTag"] = q.dataExportTag
+	}
+	if q.qType.choicesAreQuestions() {
+		if !equalChoices(q.subQuestions, orig.subQuestions) {
+			if err := patchChoices(payload, "Choices", "ChoiceOrder", "NextChoiceId", q.subQuestions, "ChoiceDataExportTags"); err != nil {
+				return fmt.Errorf("could not update choices of %s: %s", q.ID, err)
+			}
+		}
+		if !equalChoices(q.choices, orig.choices) {
+			if err := patchChoices(payload, "Answers", "AnswerOrder", "NextAnswerId", q.choices, "RecodeValues", "VariableNaming"); err != nil {
+				return fmt.Errorf("could not update answers of %s: %s", q.ID, err)
+			}
+		}
+	} else if !equalChoices(q.choices, orig.choices) {
+		if q.qType == Meta || q.dynChoices != nil {
+			return fmt.Errorf("cannot update choices of %s question %s", q.qType, q.ID)
+		}
+		if err := patchChoices(payload, "Choices", "ChoiceOrder", "NextChoiceId", q.choices, "RecodeValues", "VariableNaming"); err != nil {
+			return fmt.Errorf("could not update choices of %s: %s", q.ID, err)
+		}
+	}
+	return nil
+}
+
+// patchChoices rewrites the choice map mapKey and order orderKey of payload to match choices,
+// keeping any fields of existing choices that sp doesn't model. keyedMaps name the other maps of payload keyed by
+// the same choice IDs (e.g., RecodeValues); their entries for removed choices are deleted.
+func patchChoices(payload qsfObject, mapKey, orderKey, nextKey string, choices []Choice, keyedMaps ...string) error {
+	oldMap, ok := payload[mapKey].(qsfObject)
+	if !ok && payload[mapKey] != nil {
+		if a, isArray := payload[mapKey].([]interface{}); !isArray || len(a) > 0 {
+			return fmt.Errorf("unexpected %s format", mapKey)
+		}
+	}
+	newMap := make(qsfObject)
+	order := []interface{}{}
+	recodes, hasRecodes := payload["RecodeValues"].(qsfObject)
+	if !hasRecodes && contains(keyedMaps, "RecodeValues") {
+		// Without RecodeValues, Qualtrics records each choice's ID, so only add them if a choice's recode differs
+		for _, c := range choices {
+			if c.Recode != "" && c.Recode != c.ID {
+				recodes, hasRecodes = make(qsfObject), true
+				payload["RecodeValues"] = recodes
+				break
+			}
+		}
+	}
+	next := 0
+	for _, c := range choices {
+		entry, ok := oldMap[c.ID].(qsfObject)
+		if !ok {
+			entry = make(qsfObject)
+		}
+		entry["Display"] = c.Label
+		if c.HasText {
+			entry["TextEntry"] = "true"
+		} else {
+			delete(entry, "TextEntry")
+		}
+		newMap[c.ID] = entry
+		order = append(order, c.ID)
+		if hasRecodes && c.Recode != "" {
+			recodes[c.ID] = c.Recode
+		}
+		if id, err := strconv.Atoi(c.ID); err == nil && id >= next {
+			next = id + 1
+		}
+	}
+	for id := range oldMap {
+		if _, ok := newMap[id]; ok {
+			continue
+		}
+		for _, key := range keyedMaps {
+			if m, ok := payload[key].(qsfObject); ok {
+				delete(m, id)
+			}
+		}
+	}
+	payload[mapKey] = newMap
+	payload[orderKey] = order
+	if n, err := strconv.Atoi(fmt.Sprintf("%v", payload[nextKey])); err != nil || n < next {
+		payload[nextKey] = next
+	}
+	return nil
+}
+
+func (s *Survey) patchBlockElement(element qsfObject) {
+	var payloads []interface{}
+	switch p := element["Payload"].(type) {
+	case []interface{}:
+		payloads = p
+	case qsfObject:
+		for _, v := range p {
+			payloads = append(payloads, v)
+		}
+	}
+	for _, p := range payloads {
+		payload, ok := p.(qsfObject)
+		if !ok {
+			continue
+		}
+		id, _ := payload["ID"].(string)
+		b, ok := s.blocks[id]
+		if !ok || equalStrings(b.QuestionIDs, s.original.blocks[id]) {
+			continue
+		}
+		// Keep page breaks and other elements in place, filling the question slots in the new order
+		oldElements, _ := payload["BlockElements"].([]interface{})
+		newElements := []interface{}{}
+		next := 0
+		for _, e := range oldElements {
+			be, ok := e.(qsfObject)
+			if !ok || be["Type"] != "Question" {
+				newElements = append(newElements, e)
+				continue
+			}
+			if next < len(b.QuestionIDs) {
+				newElements = append(newElements, qsfObject{"Type": "Question", "QuestionID": b.QuestionIDs[next]})
+				next++
+			}
+		}
+		for ; next < len(b.QuestionIDs); next++ {
+			newElements = append(newElements, qsfObject{"Type": "Question", "QuestionID": b.QuestionIDs[next]})
+		}
+		payload["BlockElements"] = newElements
+	}
+}
+
+// reorderFlow reorders the blocks in flow (and any nested flows) to match blockOrder.
+// Blocks only move between the positions already held by blocks in the same flow.
+func reorderFlow(flow qsfObject, blockOrder []string) {
+	children, ok := flow["Flow"].([]interface{})
+	if !ok {
+		return
+	}
+	inFlow := make(map[string]qsfObject)
+	slots := []int{}
+	for i, c := range children {
+		child, ok := c.(qsfObject)
+		if !ok {
+			continue
+		}
+		if id, ok := child["ID"].(string); ok && id != "" {
+			inFlow[id] = child
+			slots = append(slots, i)
+		} else {
+			reorderFlow(child, blockOrder)
+		}
+	}
+	next := 0
+	for _, id := range blockOrder {
+		if child, ok := inFlow[id]; ok && next < len(slots) {
+			children[slots[next]] = child
+			next++
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalChoices(a, b []Choice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Label != b[i].Label || a[i].HasText != b[i].HasText || a[i].Recode != b[i].Recode {
+			return false
+		}
+	}
+	return true
+}
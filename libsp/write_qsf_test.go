@@ -0,0 +1,218 @@
+package libsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteQsfUnchanged(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	// The output should hold the same JSON as the input, including fields sp doesn't model
+	var want, got interface{}
+	if err = json.Unmarshal([]byte(qsfTestContent), &want); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if !bytes.Equal(wantJSON, gotJSON) {
+		t.Errorf("WriteQsf() changed the survey definition")
+	}
+}
+
+func TestWriteQsfChanges(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.Title = "Edited survey"
+	s.Questions["QID1"].SetExportTag("Q1_renamed")
+	s.Questions["QID1"].Wording = "Pick one"
+	if _, err = s.Questions["QID1"].AddChoice("A new choice"); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if _, err = s.Questions["QID14"].AddChoice("Not allowed"); err == nil {
+		t.Errorf("AddChoice() on a Description question should fail")
+	}
+	order := s.BlockOrder()
+	order[0], order[1] = order[1], order[0]
+	if err = s.SetBlockOrder(order); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.SetBlockOrder(order[1:]); err == nil {
+		t.Errorf("SetBlockOrder() with a missing block should fail")
+	}
+
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	out := b.String()
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if s2.Title != "Edited survey" {
+		t.Errorf("Title = '%s'; want 'Edited survey'", s2.Title)
+	}
+	q := s2.Questions["QID1"]
+	if q.ExportTag() != "Q1_renamed" {
+		t.Errorf("ExportTag() = '%s'; want 'Q1_renamed'", q.ExportTag())
+	}
+	if q.Wording != "Pick one" {
+		t.Errorf("Wording = '%s'; want 'Pick one'", q.Wording)
+	}
+	choices := q.ResponseChoices()
+	// QID1's NextChoiceId is 5: choice 4 was deleted, and its ID must not be reused
+	if len(choices) != 4 || choices[3].Label != "A new choice" || choices[3].ID != "5" {
+		t.Errorf("choices = %+v; want a 4th choice labeled 'A new choice' with ID 5", choices)
+	}
+	if q.nextChoiceID != 6 {
+		t.Errorf("NextChoiceId = %d; want 6", q.nextChoiceID)
+	}
+	if !equalStrings(s2.BlockOrder(), order) {
+		t.Errorf("BlockOrder() = %v; want %v", s2.BlockOrder(), order)
+	}
+	if s2.QuestionOrder[0] != s.blocks[order[0]].QuestionIDs[0] {
+		t.Errorf("QuestionOrder[0] = %s; want %s", s2.QuestionOrder[0], s.blocks[order[0]].QuestionIDs[0])
+	}
+	if !strings.Contains(out, `"QuestionDescriptionOption":"SpecifyLabel"`) {
+		t.Errorf("WriteQsf() dropped fields sp doesn't model")
+	}
+}
+
+func TestAddChoice(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s.Questions["QID18"].choices[1].Recode = "10"
+	tests := []struct {
+		qid         string
+		labels      []string
+		want        []string
+		wantRecodes []string
+		err         string
+	}{
+		{"QID1", []string{"a", "b"}, []string{"5", "6"}, []string{"4", "5"}, ""},
+		{"QID19", []string{"a"}, []string{"7"}, []string{"5"}, ""},
+		{"QID5", []string{"a"}, []string{"5"}, []string{"5"}, ""},
+		{"QID18", []string{"a"}, []string{"5"}, []string{"11"}, ""},
+		{"QID14", []string{"a"}, nil, nil, "cannot add choices to Description question QID14"},
+		{"QID21", []string{"a"}, nil, nil, "question QID21 uses dynamic choices"},
+	}
+	for _, test := range tests {
+		q := s.Questions[test.qid]
+		for i, label := range test.labels {
+			c, err := q.AddChoice(label)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("%s AddChoice() err = %v; want '%s'", test.qid, err, test.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s AddChoice() err = %s", test.qid, err)
+				continue
+			}
+			if c.ID != test.want[i] {
+				t.Errorf("%s AddChoice('%s').ID = '%s'; want '%s'", test.qid, label, c.ID, test.want[i])
+			}
+			if c.Recode != test.wantRecodes[i] {
+				t.Errorf("%s AddChoice('%s').Recode = '%s'; want '%s'", test.qid, label, c.Recode, test.wantRecodes[i])
+			}
+		}
+	}
+
+	// New recode values that differ from the choice IDs are written even if the QSF had no RecodeValues
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	s2, err := ReadQsf(bufio.NewReader(&b))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if got := choiceCodes(s2.Questions["QID1"].choices); got != "1, 2, 3, 4, 5" {
+		t.Errorf("QID1 recode values after WriteQsf = %s; want 1, 2, 3, 4, 5", got)
+	}
+
+	// A constant sum question's columns are its subquestions, so new answers wouldn't appear anywhere
+	q := &Question{ID: "QID99", qType: ConstantSum}
+	if _, err := q.AddChoice("a"); err == nil {
+		t.Errorf("AddChoice() on a ConstantSum question should fail")
+	}
+}
+
+func TestWriteQsfRemovedChoices(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	// Remove QID5's "Other" statement and "n/a" scale point, and QID19's "None" choice
+	s.Questions["QID5"].subQuestions = s.Questions["QID5"].subQuestions[:3]
+	s.Questions["QID5"].choices = s.Questions["QID5"].choices[:3]
+	s.Questions["QID19"].choices = s.Questions["QID19"].choices[:3]
+
+	var b bytes.Buffer
+	if err = s.WriteQsf(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var doc qsfObject
+	if err = json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	payloads := make(map[string]qsfObject)
+	for _, e := range doc["SurveyElements"].([]interface{}) {
+		if element := e.(qsfObject); element["Element"] == "SQ" {
+			payloads[element["PrimaryAttribute"].(string)] = element["Payload"].(qsfObject)
+		}
+	}
+	tests := []struct {
+		qid  string
+		key  string
+		want int // the number of entries left
+	}{
+		{"QID5", "Choices", 3},
+		{"QID5", "ChoiceDataExportTags", 3},
+		{"QID5", "Answers", 3},
+		{"QID5", "RecodeValues", 3},
+		{"QID5", "VariableNaming", 3},
+		{"QID19", "Choices", 3},
+		{"QID19", "VariableNaming", 3},
+	}
+	for _, test := range tests {
+		m, _ := payloads[test.qid][test.key].(qsfObject)
+		if _, ok := m["4"]; ok || len(m) != test.want {
+			t.Errorf("%s %s = %v; want %d entries, without 4", test.qid, test.key, m, test.want)
+		}
+	}
+}
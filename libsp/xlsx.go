@@ -0,0 +1,281 @@
+package libsp
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cell styles defined in xlsxStyles
+const (
+	xlsxStyleDefault  = 0
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleHeader   = 3
+)
+
+// xlsxCell is a single spreadsheet cell
+type xlsxCell struct {
+	cellType string // "b", "n", or "inlineStr"
+	value    string
+	style    int
+}
+
+// xlsxPart is a single file in the xlsx archive
+type xlsxPart struct {
+	name    string
+	content string
+}
+
+// xlsxSheet is a named worksheet; the first row is written as a frozen header
+type xlsxSheet struct {
+	name string
+	rows [][]xlsxCell
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+// xlsxEpoch is day zero of Excel's date system
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// WriteXLSX saves the parsed survey as an Excel workbook with three sheets:
+// data (the same columns as WriteCSV, with boolean, number, and date cells), codebook (each column's question and levels),
+// and survey (the survey's title, description, dates, and status).
+func (s *Survey) WriteXLSX(bw *bufio.Writer) error {
+	if bw == nil {
+		return errors.New("bw cannot be nil")
+	}
+
+	sheets := []xlsxSheet{s.xlsxDataSheet(), s.xlsxCodebookSheet(), s.xlsxSurveySheet()}
+	z := zip.NewWriter(bw)
+	parts := []xlsxPart{
+		{"[Content_Types].xml", xlsxContentTypesFor(sheets)},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(sheets)},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+	for _, p := range parts {
+		fw, err := z.Create(p.name)
+		if err != nil {
+			return fmt.Errorf("could not create %s: %s", p.name, err)
+		}
+		if _, err = fw.Write([]byte(p.content)); err != nil {
+			return fmt.Errorf("could not write %s: %s", p.name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return fmt.Errorf("could not close xlsx archive: %s", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("could not flush xlsx Writer: %s", err)
+	}
+	return nil
+}
+
+func (s *Survey) xlsxDataSheet() xlsxSheet {
+	sheet := xlsxSheet{name: "data"}
+	sheet.rows = append(sheet.rows, xlsxHeaderRow(s.csvCols()))
+	colTypes := s.csvColTypes()
+	for _, r := range s.Responses {
+		values := s.csvRow(r)
+		row := make([]xlsxCell, len(values))
+		for i, v := range values {
+			row[i] = xlsxValue(colTypes[i], v)
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	return sheet
+}
+
+func (s *Survey) xlsxCodebookSheet() xlsxSheet {
+	sheet := xlsxSheet{name: "codebook"}
+	sheet.rows = append(sheet.rows, xlsxHeaderRow(codebookHeader))
+	for _, e := range s.codebook() {
+		row := []xlsxCell{}
+		for _, v := range e.row() {
+			row = append(row, xlsxString(v))
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	return sheet
+}
+
+func (s *Survey) xlsxSurveySheet() xlsxSheet {
+	sheet := xlsxSheet{name: "survey"}
+	sheet.rows = append(sheet.rows,
+		xlsxHeaderRow([]string{"field", "value"}),
+		[]xlsxCell{xlsxString("id"), xlsxString(s.ID)},
+		[]xlsxCell{xlsxString("title"), xlsxString(s.Title)},
+		[]xlsxCell{xlsxString("description"), xlsxString(s.Description)},
+		[]xlsxCell{xlsxString("status"), xlsxString(s.Status)},
+		[]xlsxCell{xlsxString("language"), xlsxString(s.Language)},
+		[]xlsxCell{xlsxString("created"), xlsxValue("col_datetime()", formatTime(s.CreatedOn))},
+		[]xlsxCell{xlsxString("launched"), xlsxValue("col_datetime()", formatTime(s.LaunchedOn))},
+		[]xlsxCell{xlsxString("modified"), xlsxValue("col_datetime()", formatTime(s.ModifiedOn))},
+		[]xlsxCell{xlsxString("questions"), xlsxValue("col_integer()", strconv.Itoa(len(s.QuestionOrder)))},
+		[]xlsxCell{xlsxString("responses"), xlsxValue("col_integer()", strconv.Itoa(len(s.Responses)))},
+	)
+	return sheet
+}
+
+func xlsxHeaderRow(names []string) []xlsxCell {
+	row := make([]xlsxCell, len(names))
+	for i, name := range names {
+		row[i] = xlsxString(name)
+		row[i].style = xlsxStyleHeader
+	}
+	return row
+}
+
+func xlsxString(v string) xlsxCell {
+	return xlsxCell{cellType: "inlineStr", value: v}
+}
+
+// xlsxValue converts the CSV cell v to a cell matching the R column type rColType.
+// Cells that can't be converted are written as text.
+func xlsxValue(rColType string, v string) xlsxCell {
+	if v == "" {
+		return xlsxCell{}
+	}
+	switch rColType {
+	case "col_logical()":
+		if b, err := strconv.ParseBool(v); err == nil {
+			if b {
+				return xlsxCell{cellType: "b", value: "1"}
+			}
+			return xlsxCell{cellType: "b", value: "0"}
+		}
+	case "col_integer()", "col_double()":
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return xlsxCell{cellType: "n", value: v}
+		}
+	case "col_date()":
+		if t, err := time.Parse(dateFormat, v); err == nil {
+			return xlsxCell{cellType: "n", value: xlsxSerial(t), style: xlsxStyleDate}
+		}
+	case "col_datetime()":
+		if t, err := time.Parse(timeFormat, v); err == nil {
+			return xlsxCell{cellType: "n", value: xlsxSerial(t), style: xlsxStyleDateTime}
+		}
+	}
+	return xlsxString(v)
+}
+
+// xlsxSerial returns t as an Excel serial date, i.e., days since xlsxEpoch
+func xlsxSerial(t time.Time) string {
+	days := t.Sub(xlsxEpoch).Seconds() / (24 * 60 * 60)
+	return strconv.FormatFloat(days, 'f', -1, 64)
+}
+
+// xlsxColumnName returns the spreadsheet column name for the 0-based index i, e.g., 0 -> A, 26 -> AA
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func (sheet xlsxSheet) xml() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>
+`)
+	for i, row := range sheet.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row {
+			if c.cellType == "" || c.value == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s%d"`, xlsxColumnName(j), i+1)
+			if c.style != xlsxStyleDefault {
+				fmt.Fprintf(&b, ` s="%d"`, c.style)
+			}
+			fmt.Fprintf(&b, ` t="%s">`, c.cellType)
+			if c.cellType == "inlineStr" {
+				b.WriteString(`<is><t xml:space="preserve">`)
+				xml.EscapeText(&b, []byte(c.value))
+				b.WriteString(`</t></is>`)
+			} else {
+				fmt.Fprintf(&b, `<v>%s</v>`, c.value)
+			}
+			b.WriteString(`</c>`)
+		}
+		b.WriteString("</row>\n")
+	}
+	b.WriteString("</sheetData>\n</worksheet>")
+	return b.String()
+}
+
+func xlsxContentTypesFor(sheets []xlsxSheet) string {
+	overrides := ""
+	for i := range sheets {
+		overrides += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+	}
+	return fmt.Sprintf(xlsxContentTypes, overrides)
+}
+
+func xlsxWorkbook(sheets []xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+`)
+	for i, sheet := range sheets {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(sheet.name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`+"\n", i+1, i+1)
+	}
+	b.WriteString("</sheets>\n</workbook>")
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheets []xlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	for i := range sheets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(sheets)+1)
+	b.WriteString("</Relationships>")
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package libsp
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+type testWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref   string `xml:"r,attr"`
+			Type  string `xml:"t,attr"`
+			Style string `xml:"s,attr"`
+			Value string `xml:"v"`
+			Text  string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriteXLSX(t *testing.T) {
+	s, err := ReadQsf(bufio.NewReader(strings.NewReader(qsfTestContent)))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	if err = s.ReadXML(bufio.NewReader(strings.NewReader(xmlTestContent))); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	var b bytes.Buffer
+	if err = s.WriteXLSX(bufio.NewWriter(&b)); err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Errorf("err = %s", err)
+		return
+	}
+	sheets := make(map[string]testWorksheet)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Errorf("%s: err = %s", f.Name, err)
+			return
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		var ws testWorksheet
+		if err = xml.Unmarshal(content, &ws); err != nil {
+			t.Errorf("%s is not valid XML: %s", f.Name, err)
+			return
+		}
+		sheets[f.Name] = ws
+	}
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"} {
+		if _, ok := sheets[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	cell := func(sheet string, ref string) (cellType, value string) {
+		for _, row := range sheets[sheet].Rows {
+			for _, c := range row.Cells {
+				if c.Ref == ref {
+					return c.Type, c.Value + c.Text
+				}
+			}
+		}
+		return "", ""
+	}
+	tests := []struct {
+		sheet    string
+		ref      string
+		wantType string
+		want     string
+	}{
+		{"xl/worksheets/sheet1.xml", "A1", "inlineStr", "id"},
+		{"xl/worksheets/sheet1.xml", "A2", "inlineStr", "R_1dtWhiBDD96nfyk"},
+		{"xl/worksheets/sheet1.xml", "B2", "b", "1"},
+		{"xl/worksheets/sheet1.xml", "C2", "n", "100"},
+		{"xl/worksheets/sheet1.xml", "E2", "n", "43697.53091435185"},
+		{"xl/worksheets/sheet2.xml", "A3", "inlineStr", "finished"},
+		{"xl/worksheets/sheet2.xml", "G3", "inlineStr", "logical"},
+		{"xl/worksheets/sheet3.xml", "B3", "inlineStr", "Test survey"},
+	}
+	for _, test := range tests {
+		cellType, value := cell(test.sheet, test.ref)
+		if cellType != test.wantType || value != test.want {
+			t.Errorf("%s!%s = (%s, '%s'); want (%s, '%s')", test.sheet, test.ref, cellType, value, test.wantType, test.want)
+		}
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, test := range tests {
+		if got := xlsxColumnName(test.i); got != test.want {
+			t.Errorf("xlsxColumnName(%d) = %s; want %s", test.i, got, test.want)
+		}
+	}
+}